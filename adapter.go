@@ -0,0 +1,526 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// debugAdapter describes a kind of debug adapter: how to start it, how to
+// tell when it accepts connections and how to shape the arguments of its
+// launch and attach requests, which the DAP specification leaves to each adapter.
+type debugAdapter struct {
+	// name selects the adapter in the adapter parameter of start-debugger.
+	name string
+	// id is sent as adapterID in the initialize request.
+	id string
+	// command returns the command line that starts the adapter. For adapters
+	// that listen on a socket, listen is the address to listen on, either
+	// host:port or unix:path.
+	command func(listen string) []string
+	// listens reports whether the adapter accepts a connection on a socket
+	// instead of speaking DAP over its standard input and output.
+	listens bool
+	// ready reports whether a line the adapter printed to its standard output
+	// means that it accepts connections. It is only used when listens is set.
+	ready func(line string) bool
+	// answersAfterConfiguration reports whether the adapter only answers
+	// launch and attach requests once configurationDone was received.
+	answersAfterConfiguration bool
+	// restartKeepsEnv reports whether the adapter ignores the environment
+	// in the arguments of a restart request and keeps that of the first launch.
+	restartKeepsEnv bool
+	// launchArguments returns the arguments of a launch request.
+	launchArguments func(config launchConfig) (map[string]any, error)
+	// attachArguments returns the arguments of an attach request.
+	attachArguments func(config attachConfig) (map[string]any, error)
+}
+
+// launchConfig describes the program a launch request starts.
+type launchConfig struct {
+	// Mode is how the program is started: "debug" to build and debug
+	// it, or "exec" to debug an already built executable.
+	Mode    string
+	Program string
+	// Args are the command line arguments of the program.
+	Args []string
+	// Cwd is the working directory of the program.
+	Cwd string
+	// Env holds variables added to the environment of the program.
+	Env map[string]string
+	// Console is where the program runs: internalConsole or integratedTerminal.
+	Console string
+	// BuildFlags, Output, HideSystemGoroutines and ShowGlobalVariables
+	// are the Delve options of the same name.
+	BuildFlags           string
+	Output               string
+	HideSystemGoroutines bool
+	ShowGlobalVariables  bool
+	// CoreFile is the core dump debugged in core mode, with Program the executable that produced it.
+	CoreFile string
+	// Module is a Python module to run instead of Program.
+	Module string
+	// JustMyCode restricts Python stepping to user code; nil keeps the adapter default.
+	JustMyCode *bool
+	// Python is the path of the Python interpreter that runs the program.
+	Python string
+}
+
+// checkNotPython returns an error if config uses options that only
+// Python adapters understand.
+func (config launchConfig) checkNotPython(adapter string) error {
+	if config.Module != "" || config.JustMyCode != nil || config.Python != "" {
+		return fmt.Errorf("module, justMyCode and python are not supported by the %s adapter", adapter)
+	}
+	return nil
+}
+
+// checkNotDelve returns an error if config uses options that only Delve understands.
+func (config launchConfig) checkNotDelve(adapter string) error {
+	if config.BuildFlags != "" || config.Output != "" || config.HideSystemGoroutines || config.ShowGlobalVariables {
+		return fmt.Errorf("buildFlags, output, hideSystemGoroutines and showGlobalVariables are not supported by the %s adapter", adapter)
+	}
+	return nil
+}
+
+// addCommon adds the arguments, working directory, environment and console
+// of the program, when set, to args. Most adapters name them the same way.
+func (config launchConfig) addCommon(args map[string]any) {
+	if len(config.Args) > 0 {
+		args["args"] = config.Args
+	}
+	if config.Cwd != "" {
+		args["cwd"] = config.Cwd
+	}
+	if len(config.Env) > 0 {
+		args["env"] = config.Env
+	}
+	if config.Console != "" {
+		args["console"] = config.Console
+	}
+}
+
+// attachConfig describes the process an attach request attaches to.
+type attachConfig struct {
+	// Mode is "local" to attach to a process by ID, or "remote" to
+	// debug the process of the headless Delve server the session is connected to.
+	Mode      string
+	ProcessID int
+	// SubstitutePath maps local source paths to the paths
+	// the debugged program was built with.
+	SubstitutePath []substitutePath
+}
+
+// substitutePath maps a local source directory to the remote one.
+type substitutePath struct {
+	From string `json:"from" mcp:"local path"`
+	To   string `json:"to" mcp:"remote path, as known to the debugged program"`
+}
+
+// checkLocal returns an error if config is not in local mode: the remote mode
+// is Delve's, and other adapters would attach to process 0 instead.
+func (config attachConfig) checkLocal(adapter string) error {
+	if config.Mode != "local" {
+		return fmt.Errorf("the %s adapter only attaches in local mode, to a process ID", adapter)
+	}
+	return nil
+}
+
+// checkNoSubstitutePath returns an error if config maps source paths, which the adapter cannot do.
+func (config attachConfig) checkNoSubstitutePath(adapter string) error {
+	if len(config.SubstitutePath) > 0 {
+		return fmt.Errorf("substitutePath is not supported by the %s adapter", adapter)
+	}
+	return nil
+}
+
+// defaultAdapter is used when start-debugger is not given an adapter.
+const defaultAdapter = "dlv"
+
+// adapters lists the supported debug adapters by name.
+var adapters = map[string]*debugAdapter{
+	"dlv":      delveAdapter,
+	"debugpy":  debugpyAdapter,
+	"lldb-dap": lldbAdapter,
+	"gdb":      gdbAdapter,
+}
+
+// delveAdapter runs Delve's DAP server, which listens on a socket and
+// announces when it is ready on its standard output. Its protocol log is not
+// turned on: it would crowd the program output out of the output buffer,
+// and DAP traces record the protocol instead.
+var delveAdapter = &debugAdapter{
+	name: "dlv",
+	id:   "go",
+	command: func(listen string) []string {
+		return []string{"dlv", "dap", "--listen", listen}
+	},
+	listens: true,
+	ready: func(line string) bool {
+		return strings.HasPrefix(line, "DAP server listening at")
+	},
+	// Delve only takes the program arguments and build flags from a restart request.
+	restartKeepsEnv: true,
+	launchArguments: func(config launchConfig) (map[string]any, error) {
+		if err := config.checkNotPython("dlv"); err != nil {
+			return nil, err
+		}
+		args := map[string]any{
+			"request":     "launch",
+			"mode":        config.Mode,
+			"program":     config.Program,
+			"stopOnEntry": true,
+		}
+		config.addCommon(args)
+		if config.BuildFlags != "" {
+			args["buildFlags"] = config.BuildFlags
+		}
+		if config.Output != "" {
+			args["output"] = config.Output
+		}
+		if config.HideSystemGoroutines {
+			args["hideSystemGoroutines"] = true
+		}
+		if config.ShowGlobalVariables {
+			args["showGlobalVariables"] = true
+		}
+		if config.CoreFile != "" {
+			args["coreFilePath"] = config.CoreFile
+		}
+		return args, nil
+	},
+	attachArguments: func(config attachConfig) (map[string]any, error) {
+		args := map[string]any{
+			"request": "attach",
+			"mode":    config.Mode,
+		}
+		// In remote mode the headless server already debugs its process.
+		if config.Mode != "remote" {
+			args["processId"] = config.ProcessID
+		}
+		// Delve translates paths both ways: breakpoint files on their way
+		// to the target and source paths in the stack frames it returns.
+		if len(config.SubstitutePath) > 0 {
+			args["substitutePath"] = config.SubstitutePath
+		}
+		return args, nil
+	},
+}
+
+// debugpyAdapter runs the debug adapter of debugpy, which speaks DAP over
+// its standard input and output and debugs Python programs.
+var debugpyAdapter = &debugAdapter{
+	name: "debugpy",
+	id:   "debugpy",
+	command: func(string) []string {
+		return []string{"python3", "-m", "debugpy.adapter"}
+	},
+	answersAfterConfiguration: true,
+	launchArguments: func(config launchConfig) (map[string]any, error) {
+		if config.Mode != "debug" {
+			return nil, fmt.Errorf("the debugpy adapter cannot %s a program: use debug-program", config.Mode)
+		}
+		if err := config.checkNotDelve("debugpy"); err != nil {
+			return nil, err
+		}
+		args := map[string]any{
+			"request":     "launch",
+			"stopOnEntry": true,
+		}
+		switch {
+		case config.Module != "" && config.Program != "":
+			return nil, errors.New("path and module are mutually exclusive")
+		case config.Module != "":
+			args["module"] = config.Module
+		case config.Program != "":
+			args["program"] = config.Program
+		default:
+			return nil, errors.New("either path or module is required")
+		}
+		config.addCommon(args)
+		if config.JustMyCode != nil {
+			args["justMyCode"] = *config.JustMyCode
+		}
+		if config.Python != "" {
+			args["python"] = config.Python
+		}
+		return args, nil
+	},
+	attachArguments: func(config attachConfig) (map[string]any, error) {
+		if err := config.checkLocal("debugpy"); err != nil {
+			return nil, err
+		}
+		args := map[string]any{
+			"request":   "attach",
+			"processId": config.ProcessID,
+		}
+		if len(config.SubstitutePath) > 0 {
+			var mappings []map[string]string
+			for _, rule := range config.SubstitutePath {
+				mappings = append(mappings, map[string]string{"localRoot": rule.From, "remoteRoot": rule.To})
+			}
+			args["pathMappings"] = mappings
+		}
+		return args, nil
+	},
+}
+
+// lldbAdapter runs lldb-dap, LLVM's debug adapter for native programs
+// such as C, C++ and Rust, over its standard input and output.
+var lldbAdapter = &debugAdapter{
+	name: "lldb-dap",
+	id:   "lldb-dap",
+	command: func(string) []string {
+		return []string{"lldb-dap"}
+	},
+	answersAfterConfiguration: true,
+	launchArguments: func(config launchConfig) (map[string]any, error) {
+		args, err := nativeLaunchArguments("lldb-dap", config)
+		if err != nil {
+			return nil, err
+		}
+		args["stopOnEntry"] = true
+		// lldb-dap takes the environment as a list of VAR=value strings.
+		if len(config.Env) > 0 {
+			var env []string
+			for name, value := range config.Env {
+				env = append(env, name+"="+value)
+			}
+			slices.Sort(env)
+			args["env"] = env
+		}
+		if config.Console == "integratedTerminal" {
+			args["runInTerminal"] = true
+		}
+		return args, nil
+	},
+	attachArguments: func(config attachConfig) (map[string]any, error) {
+		return nativeAttachArguments("lldb-dap", config)
+	},
+}
+
+// gdbAdapter runs GDB 14 or later with its DAP interpreter, which
+// speaks DAP over its standard input and output.
+var gdbAdapter = &debugAdapter{
+	name: "gdb",
+	id:   "gdb",
+	command: func(string) []string {
+		return []string{"gdb", "-i", "dap"}
+	},
+	answersAfterConfiguration: true,
+	launchArguments: func(config launchConfig) (map[string]any, error) {
+		if config.Console == "integratedTerminal" {
+			return nil, errors.New("the gdb adapter cannot run programs in a terminal")
+		}
+		args, err := nativeLaunchArguments("gdb", config)
+		if err != nil {
+			return nil, err
+		}
+		// GDB 14 does not know stopOnEntry; stopping at main
+		// leaves room to configure breakpoints all the same.
+		args["stopAtBeginningOfMainSubprogram"] = true
+		return args, nil
+	},
+	attachArguments: func(config attachConfig) (map[string]any, error) {
+		return nativeAttachArguments("gdb", config)
+	},
+}
+
+// nativeLaunchArguments returns the launch arguments shared by the adapters of native
+// debuggers: the common ones, except for the console, which each of them handles differently.
+// Those adapters cannot build programs, so the program must be an executable
+// and the debug and exec modes are the same.
+func nativeLaunchArguments(adapter string, config launchConfig) (map[string]any, error) {
+	if err := config.checkNotPython(adapter); err != nil {
+		return nil, err
+	}
+	if err := config.checkNotDelve(adapter); err != nil {
+		return nil, err
+	}
+	if config.Program == "" {
+		return nil, errors.New("path is required")
+	}
+	args := map[string]any{
+		"request": "launch",
+		"program": config.Program,
+	}
+	config.addCommon(args)
+	delete(args, "console")
+	return args, nil
+}
+
+// nativeAttachArguments returns the attach arguments of the adapters of native debuggers.
+func nativeAttachArguments(adapter string, config attachConfig) (map[string]any, error) {
+	if err := config.checkLocal(adapter); err != nil {
+		return nil, err
+	}
+	if err := config.checkNoSubstitutePath(adapter); err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"request": "attach",
+		"pid":     config.ProcessID,
+	}, nil
+}
+
+// lookupAdapter returns the adapter with the given name, or the default adapter if name is empty.
+func lookupAdapter(name string) (*debugAdapter, error) {
+	if name == "" {
+		name = defaultAdapter
+	}
+	adapter, ok := adapters[name]
+	if !ok {
+		names := make([]string, 0, len(adapters))
+		for name := range adapters {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return nil, fmt.Errorf("unknown debug adapter %q: expected one of %s", name, strings.Join(names, ", "))
+	}
+	return adapter, nil
+}
+
+// startAdapter starts the debug adapter for the session and connects ds.client to it.
+// If command is not empty, it replaces the adapter's own command line and the
+// adapter is expected to speak DAP over its standard input and output.
+// It returns a description of where the adapter runs.
+func (ds *debuggerSession) startAdapter(adapter *debugAdapter, params StartDebuggerParams) (string, error) {
+	if command := params.Command; len(command) > 0 || !adapter.listens {
+		if len(command) == 0 {
+			command = adapter.command("")
+		}
+		ds.cmd = exec.Command(command[0], command[1:]...)
+		ds.cmd.Stderr = io.MultiWriter(os.Stderr, ds.output.writer("adapter"))
+		// Don't let a child of the adapter that inherited its stderr block Wait.
+		ds.cmd.WaitDelay = time.Second
+		setProcessGroup(ds.cmd)
+		client, err := newStdioDAPClient(ds.cmd)
+		if err != nil {
+			ds.cmd = nil
+			return "", fmt.Errorf("unable to start %s: %w", adapter.name, err)
+		}
+		ds.client = client
+		return "stdio of " + strings.Join(command, " "), nil
+	}
+
+	network, addr, err := ds.listenAddress(params)
+	if err != nil {
+		return "", err
+	}
+	listen := addr
+	if network == "unix" {
+		listen = "unix:" + addr
+	}
+	command := adapter.command(listen)
+	ds.cmd = exec.Command(command[0], command[1:]...)
+	ds.cmd.Stderr = io.MultiWriter(os.Stderr, ds.output.writer("adapter"))
+	ds.cmd.WaitDelay = time.Second
+	setProcessGroup(ds.cmd)
+	stdout, err := ds.cmd.StdoutPipe()
+	if err != nil {
+		ds.cmd = nil
+		return "", err
+	}
+	if err := ds.cmd.Start(); err != nil {
+		ds.cmd = nil
+		return "", fmt.Errorf("unable to start %s: %w", adapter.name, err)
+	}
+	if err := waitReady(adapter, stdout, ds.output); err != nil {
+		ds.killAdapter()
+		return "", ds.adapterFailure(adapter, err)
+	}
+
+	client, err := newDAPClient(network, addr)
+	if err != nil {
+		ds.killAdapter()
+		return "", ds.adapterFailure(adapter, err)
+	}
+	ds.client = client
+	return listen, nil
+}
+
+// startupTimeout bounds how long start-debugger waits for an adapter to accept
+// connections. It can be configured with the MCP_DAP_STARTUP_TIMEOUT environment variable.
+var startupTimeout = durationFromEnv("MCP_DAP_STARTUP_TIMEOUT", 30*time.Second)
+
+// waitReady reads the standard output of a listening adapter until it announces
+// that it accepts connections, the adapter exits or startupTimeout elapses.
+// Everything else the adapter prints is recorded in output.
+func waitReady(adapter *debugAdapter, stdout io.Reader, output *outputBuffer) error {
+	ready := make(chan error, 1)
+	go func() {
+		r := bufio.NewReader(stdout)
+		announced := false
+		for {
+			line, err := r.ReadString('\n')
+			if !announced && adapter.ready(line) {
+				announced = true
+				ready <- nil
+			} else if line != "" {
+				output.write("adapter", line, "", 0)
+			}
+			if err != nil {
+				if !announced {
+					ready <- fmt.Errorf("%s exited before accepting connections", adapter.name)
+				}
+				return
+			}
+		}
+	}()
+
+	timer := time.NewTimer(startupTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-ready:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("%s did not accept connections within %s", adapter.name, startupTimeout)
+	}
+}
+
+// maxStderrInError is how much of the adapter's stderr adapterFailure includes.
+const maxStderrInError = 4096
+
+// adapterFailure adds what the adapter wrote to its stderr to err, which
+// tells why the adapter could not be started.
+func (ds *debuggerSession) adapterFailure(adapter *debugAdapter, err error) error {
+	entries, _ := ds.output.since(0, func(e outputEntry) bool { return e.Category == "adapter" })
+	var stderr strings.Builder
+	for _, entry := range entries {
+		stderr.WriteString(entry.Output)
+	}
+	text := strings.TrimSpace(stderr.String())
+	if text == "" {
+		return err
+	}
+	if len(text) > maxStderrInError {
+		text = "..." + text[len(text)-maxStderrInError:]
+	}
+	return fmt.Errorf("%w\n%s output:\n%s", err, adapter.name, text)
+}
+
+// killAdapter kills the adapter process started by the session, if any, and waits for it to exit.
+func (ds *debuggerSession) killAdapter() error {
+	if ds.cmd == nil {
+		return nil
+	}
+	// The adapter runs in a process group of its own: kill everything in it,
+	// including programs it started, not just the adapter itself.
+	if err := killProcessGroup(ds.cmd); err != nil {
+		// Ignore the error if the process has already exited
+		if !errors.Is(err, os.ErrProcessDone) {
+			return err
+		}
+	}
+
+	// Wait for the process to finish
+	ds.cmd.Wait() // Ignore error as process might have been killed
+	ds.cmd = nil
+	return nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestLookupAdapter(t *testing.T) {
+	adapter, err := lookupAdapter("")
+	if err != nil || adapter.name != defaultAdapter {
+		t.Fatalf("lookupAdapter(\"\") = %v, %v; want the default adapter", adapter, err)
+	}
+	if _, err := lookupAdapter("nope"); err == nil || !strings.Contains(err.Error(), "dlv") {
+		t.Errorf("expected an error listing the known adapters, got %v", err)
+	}
+}
+
+func TestStartStdioAdapter(t *testing.T) {
+	t.Setenv("MCP_DAP_HELPER_ADAPTER", "1")
+	adapters["test"] = &debugAdapter{
+		name: "test",
+		id:   "test",
+		command: func(string) []string {
+			return []string{os.Args[0], "-test.run=^TestHelperStdioAdapter$"}
+		},
+	}
+	defer delete(adapters, "test")
+
+	ds := &debuggerSession{}
+	res, err := ds.startDebugger(context.Background(), nil, &mcp.CallToolParamsFor[StartDebuggerParams]{Arguments: StartDebuggerParams{Adapter: "test"}})
+	if err != nil {
+		t.Fatalf("startDebugger: %v", err)
+	}
+	if text := res.Content[0].(*mcp.TextContent).Text; !strings.Contains(text, "stdio of") {
+		t.Errorf("unexpected start result: %s", text)
+	}
+	if ds.adapter.name != "test" || ds.capabilities == nil || !ds.capabilities.SupportsConfigurationDoneRequest {
+		t.Errorf("session not initialized: adapter %v, capabilities %+v", ds.adapter, ds.capabilities)
+	}
+	if _, err := ds.stopDebugger(context.Background(), nil, &mcp.CallToolParamsFor[StopDebuggerParams]{}); err != nil {
+		t.Fatalf("stopDebugger: %v", err)
+	}
+}
+
+func TestDebugpyLaunchArguments(t *testing.T) {
+	justMyCode := false
+	args, err := debugpyAdapter.launchArguments(launchConfig{Mode: "debug", Module: "app.main", JustMyCode: &justMyCode, Python: "/venv/bin/python"})
+	if err != nil {
+		t.Fatalf("launchArguments: %v", err)
+	}
+	if args["module"] != "app.main" || args["justMyCode"] != false || args["python"] != "/venv/bin/python" || args["program"] != nil {
+		t.Errorf("unexpected launch arguments %v", args)
+	}
+	if _, err := debugpyAdapter.launchArguments(launchConfig{Mode: "debug", Module: "app", Program: "app.py"}); err == nil {
+		t.Error("expected path and module to be mutually exclusive")
+	}
+	if _, err := debugpyAdapter.launchArguments(launchConfig{Mode: "exec", Program: "app.py"}); err == nil {
+		t.Error("expected exec mode to be refused")
+	}
+	if _, err := delveAdapter.launchArguments(launchConfig{Mode: "debug", Module: "app"}); err == nil {
+		t.Error("expected dlv to refuse Python options")
+	}
+}
+
+func TestDelveLaunchArguments(t *testing.T) {
+	ds := &debuggerSession{adapter: delveAdapter}
+	args, err := ds.launchArguments(DebugProgramParams{
+		Path:                 "./cmd/app",
+		Env:                  map[string]string{"APP_ENV": "test"},
+		BuildFlags:           "-tags=integration",
+		HideSystemGoroutines: true,
+		LaunchArgs:           map[string]any{"stopOnEntry": true, "dlvFlags": []string{"--check-go-version=false"}},
+	}, "debug")
+	if err != nil {
+		t.Fatalf("launchArguments: %v", err)
+	}
+	got, err := json.Marshal(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"buildFlags":"-tags=integration","dlvFlags":["--check-go-version=false"],"env":{"APP_ENV":"test"},"hideSystemGoroutines":true,"mode":"debug","program":"./cmd/app","request":"launch","stopOnEntry":true}`
+	if string(got) != want {
+		t.Errorf("got launch arguments %s, want %s", got, want)
+	}
+	if _, err := gdbAdapter.launchArguments(launchConfig{Mode: "exec", Program: "./app", BuildFlags: "-race"}); err == nil {
+		t.Error("expected gdb to refuse Delve options")
+	}
+}
+
+func TestNativeLaunchArguments(t *testing.T) {
+	config := launchConfig{Mode: "exec", Program: "./app", Args: []string{"-v"}, Cwd: "/src"}
+	args, err := gdbAdapter.launchArguments(config)
+	if err != nil {
+		t.Fatalf("gdb launchArguments: %v", err)
+	}
+	if args["program"] != "./app" || args["cwd"] != "/src" || args["stopAtBeginningOfMainSubprogram"] != true || args["stopOnEntry"] != nil {
+		t.Errorf("unexpected gdb launch arguments %v", args)
+	}
+	config.Console = "integratedTerminal"
+	config.Env = map[string]string{"B": "2", "A": "1"}
+	args, err = lldbAdapter.launchArguments(config)
+	if err != nil {
+		t.Fatalf("lldb-dap launchArguments: %v", err)
+	}
+	if args["stopOnEntry"] != true || args["runInTerminal"] != true || args["console"] != nil || len(args["args"].([]string)) != 1 || !slices.Equal(args["env"].([]string), []string{"A=1", "B=2"}) {
+		t.Errorf("unexpected lldb-dap launch arguments %v", args)
+	}
+	if attach, _ := lldbAdapter.attachArguments(attachConfig{Mode: "local", ProcessID: 42}); attach["pid"] != 42 {
+		t.Errorf("unexpected lldb-dap attach arguments %v", attach)
+	}
+}
+
+func TestDelveRemoteAttachArguments(t *testing.T) {
+	args, err := delveAdapter.attachArguments(attachConfig{
+		Mode:           "remote",
+		SubstitutePath: []substitutePath{{From: "/home/me/src/app", To: "/go/src/app"}},
+	})
+	if err != nil {
+		t.Fatalf("attachArguments: %v", err)
+	}
+	got, err := json.Marshal(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"mode":"remote","request":"attach","substitutePath":[{"from":"/home/me/src/app","to":"/go/src/app"}]}`
+	if string(got) != want {
+		t.Errorf("got attach arguments %s, want %s", got, want)
+	}
+	if _, err := gdbAdapter.attachArguments(attachConfig{Mode: "local", ProcessID: 1, SubstitutePath: []substitutePath{{From: "a", To: "b"}}}); err == nil || !strings.Contains(err.Error(), "gdb adapter") {
+		t.Errorf("expected gdb to refuse substitutePath, got %v", err)
+	}
+	// Only Delve attaches to the process of the server it is connected to.
+	for _, adapter := range []*debugAdapter{debugpyAdapter, lldbAdapter} {
+		if _, err := adapter.attachArguments(attachConfig{Mode: "remote"}); err == nil || !strings.Contains(err.Error(), "the "+adapter.name+" adapter only attaches in local mode") {
+			t.Errorf("expected %s to refuse remote mode, got %v", adapter.name, err)
+		}
+	}
+}
+
+func TestStartListeningAdapter(t *testing.T) {
+	t.Setenv("MCP_DAP_HELPER_ADAPTER", "1")
+	adapters["test"] = &debugAdapter{
+		name: "test",
+		id:   "test",
+		command: func(listen string) []string {
+			return []string{"env", "MCP_DAP_HELPER_LISTEN=" + listen, os.Args[0], "-test.run=^TestHelperStdioAdapter$"}
+		},
+		listens: true,
+		ready:   delveAdapter.ready,
+	}
+	defer delete(adapters, "test")
+
+	// No port is given, so a free one is picked.
+	ds := &debuggerSession{}
+	res, err := ds.startDebugger(context.Background(), nil, &mcp.CallToolParamsFor[StartDebuggerParams]{Arguments: StartDebuggerParams{Adapter: "test"}})
+	if err != nil {
+		t.Fatalf("startDebugger: %v", err)
+	}
+	if text := res.Content[0].(*mcp.TextContent).Text; !strings.Contains(text, "127.0.0.1:") || strings.Contains(text, "127.0.0.1:0") {
+		t.Errorf("expected a free port to be picked: %s", text)
+	}
+	if _, err := ds.stopDebugger(context.Background(), nil, &mcp.CallToolParamsFor[StopDebuggerParams]{}); err != nil {
+		t.Fatalf("stopDebugger: %v", err)
+	}
+}
+
+func TestDisconnectReleasesAdapter(t *testing.T) {
+	registerTestAdapter(t)
+	ctx := context.Background()
+	ds := &debuggerSession{}
+	if _, err := ds.startDebugger(ctx, nil, &mcp.CallToolParamsFor[StartDebuggerParams]{Arguments: StartDebuggerParams{
+		Adapter: "test",
+		Trace:   filepath.Join(t.TempDir(), "trace.jsonl"),
+	}}); err != nil {
+		t.Fatalf("startDebugger: %v", err)
+	}
+	if _, err := ds.disconnect(ctx, nil, &mcp.CallToolParamsFor[DisconnectParams]{}); err != nil {
+		t.Fatalf("disconnect: %v", err)
+	}
+	if ds.client != nil || ds.cmd != nil || ds.tracer != nil {
+		t.Error("disconnect left the adapter, its connection or its trace open")
+	}
+	if got := ds.status.current(); got != stateNotStarted {
+		t.Errorf("got state %s after disconnect, want not-started", got)
+	}
+}
+
+func TestStartAdapterFailure(t *testing.T) {
+	defer func(timeout time.Duration) { startupTimeout = timeout }(startupTimeout)
+	startupTimeout = 200 * time.Millisecond
+	// The unix socket directory is created there.
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	for _, tt := range []struct {
+		script string
+		want   []string
+	}{
+		{"echo 'listen tcp 127.0.0.1:4000: bind: address already in use' >&2; exit 1", []string{"exited before accepting connections", "address already in use"}},
+		{"echo starting >&2; sleep 5", []string{"did not accept connections within", "starting"}},
+	} {
+		adapters["test"] = &debugAdapter{
+			name:    "test",
+			id:      "test",
+			command: func(string) []string { return []string{"sh", "-c", tt.script} },
+			listens: true,
+			ready:   delveAdapter.ready,
+		}
+		ds := &debuggerSession{}
+		_, err := ds.startDebugger(context.Background(), nil, &mcp.CallToolParamsFor[StartDebuggerParams]{Arguments: StartDebuggerParams{
+			Adapter: "test",
+			Listen:  "unix",
+			Trace:   filepath.Join(t.TempDir(), "trace.jsonl"),
+		}})
+		if err == nil {
+			t.Fatalf("%s: expected startDebugger to fail", tt.script)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: error %q does not mention %q", tt.script, err, want)
+			}
+		}
+		if ds.cmd != nil {
+			t.Errorf("%s: adapter process was not cleaned up", tt.script)
+		}
+		if ds.tracer != nil {
+			t.Errorf("%s: DAP trace was not closed", tt.script)
+		}
+		if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+			t.Errorf("%s: unix socket directory was not removed: %v", tt.script, entries)
+		}
+	}
+	delete(adapters, "test")
+}
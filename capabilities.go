@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/go-dap"
+)
+
+// errNotSupported is returned by tools whose DAP request the adapter
+// did not advertise support for in its initialize response.
+var errNotSupported = errors.New("not supported by this adapter")
+
+// errReadOnly is returned by tools that run or modify the program when the
+// session debugs a core file, which has no process to run.
+var errReadOnly = errors.New("not available in a read-only session")
+
+// requiredCapability describes the capability an adapter must advertise
+// before a given DAP request may be sent to it.
+type requiredCapability struct {
+	// name is the JSON name of the capability, as reported to users.
+	name      string
+	supported func(dap.Capabilities) bool
+}
+
+// requiredCapabilities lists the optional DAP requests used by the tools,
+// keyed by command. Requests not listed here must be supported by every adapter.
+var requiredCapabilities = map[string]requiredCapability{
+	"configurationDone":       {"supportsConfigurationDoneRequest", func(c dap.Capabilities) bool { return c.SupportsConfigurationDoneRequest }},
+	"setFunctionBreakpoints":  {"supportsFunctionBreakpoints", func(c dap.Capabilities) bool { return c.SupportsFunctionBreakpoints }},
+	"setVariable":             {"supportsSetVariable", func(c dap.Capabilities) bool { return c.SupportsSetVariable }},
+	"restart":                 {"supportsRestartRequest", func(c dap.Capabilities) bool { return c.SupportsRestartRequest }},
+	"terminate":               {"supportsTerminateRequest", func(c dap.Capabilities) bool { return c.SupportsTerminateRequest }},
+	"loadedSources":           {"supportsLoadedSourcesRequest", func(c dap.Capabilities) bool { return c.SupportsLoadedSourcesRequest }},
+	"modules":                 {"supportsModulesRequest", func(c dap.Capabilities) bool { return c.SupportsModulesRequest }},
+	"disassemble":             {"supportsDisassembleRequest", func(c dap.Capabilities) bool { return c.SupportsDisassembleRequest }},
+	"exceptionInfo":           {"supportsExceptionInfoRequest", func(c dap.Capabilities) bool { return c.SupportsExceptionInfoRequest }},
+	"stepBack":                {"supportsStepBack", func(c dap.Capabilities) bool { return c.SupportsStepBack }},
+	"completions":             {"supportsCompletionsRequest", func(c dap.Capabilities) bool { return c.SupportsCompletionsRequest }},
+	"breakpointLocations":     {"supportsBreakpointLocationsRequest", func(c dap.Capabilities) bool { return c.SupportsBreakpointLocationsRequest }},
+	"dataBreakpointInfo":      {"supportsDataBreakpoints", func(c dap.Capabilities) bool { return c.SupportsDataBreakpoints }},
+	"setDataBreakpoints":      {"supportsDataBreakpoints", func(c dap.Capabilities) bool { return c.SupportsDataBreakpoints }},
+	"setExceptionBreakpoints": {"exceptionBreakpointFilters", func(c dap.Capabilities) bool { return len(c.ExceptionBreakpointFilters) > 0 }},
+}
+
+// supports returns an error wrapping errNotSupported if the adapter did not
+// advertise the capability needed to serve the DAP request command.
+func (ds *debuggerSession) supports(command string) error {
+	required, ok := requiredCapabilities[command]
+	if !ok || ds.capabilities == nil || required.supported(*ds.capabilities) {
+		return nil
+	}
+	return fmt.Errorf("%s request is %w: it does not advertise %s", command, errNotSupported, required.name)
+}
+
+// canExecute returns an error wrapping errReadOnly if tool needs a live
+// process and the session debugs a core file.
+func (ds *debuggerSession) canExecute(tool string) error {
+	if ds.coreFile == "" {
+		return nil
+	}
+	return fmt.Errorf("%s is %w: the session debugs the core file %s, whose threads, stacks and variables can be inspected but not run or modified", tool, errReadOnly, ds.coreFile)
+}
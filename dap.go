@@ -2,54 +2,315 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"os/exec"
+	"sync"
+	"time"
 
 	"github.com/google/go-dap"
 )
 
 // DAPClient is a debugger service client that uses Debug Adaptor Protocol.
 // It does not (yet?) implement service.DAPClient interface.
-// All client methods are synchronous.
+// A single background goroutine reads every message sent by the server:
+// responses are routed to the caller waiting on the matching request_seq
+// and events are handed to subscribers. All request methods are synchronous
+// and safe for concurrent use.
 type DAPClient struct {
-	conn   net.Conn
+	conn   io.ReadWriteCloser
 	reader *bufio.Reader
+
+	// writeMu serializes writes so that concurrent requests
+	// are never interleaved on the wire.
+	writeMu sync.Mutex
+
+	// mu guards the fields below.
+	mu sync.Mutex
 	// seq is used to track the sequence number of each
 	// requests that the client sends to the server
 	seq int
+	// pending maps the seq of each in-flight request to the
+	// channel its response will be delivered on.
+	pending map[int]chan dap.Message
+	// subscribers are called for every event sent by the server.
+	subscribers map[int]func(dap.EventMessage)
+	nextSubID   int
+	// reverseRequestHandler answers requests sent by the server, such as runInTerminal.
+	reverseRequestHandler func(dap.RequestMessage) (dap.ResponseMessage, error)
+	// trace, if set, is called with the raw JSON of every message sent or received.
+	trace func(direction string, content []byte)
+
+	// done is closed once the read loop exits, after which err
+	// holds the reason.
+	done chan struct{}
+	err  error
+}
+
+// requestTimeout bounds how long a single request waits for its response.
+// It can be configured with the MCP_DAP_REQUEST_TIMEOUT environment variable.
+var requestTimeout = durationFromEnv("MCP_DAP_REQUEST_TIMEOUT", 30*time.Second)
+
+// buildTimeout bounds how long launch and restart requests wait for their
+// response. Delve builds the program before answering them, which can take
+// much longer than other requests. It can be configured with the
+// MCP_DAP_BUILD_TIMEOUT environment variable.
+var buildTimeout = durationFromEnv("MCP_DAP_BUILD_TIMEOUT", 10*time.Minute)
+
+// errClientClosed is reported to pending requests when the client is closed.
+var errClientClosed = errors.New("DAP client closed")
+
+// errConnectionLost is reported once the connection to the server fails.
+var errConnectionLost = errors.New("connection to DAP server lost")
+
+// dialTimeout bounds how long newDAPClient waits for the connection to be established.
+const dialTimeout = 10 * time.Second
+
+// newDAPClient creates a new Client connected to addr on the named
+// network, either "tcp" or "unix".
+// Call Close() to close the connection.
+func newDAPClient(network, addr string) (*DAPClient, error) {
+	conn, err := net.DialTimeout(network, addr, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to DAP server at %s: %w", addr, err)
+	}
+	return newDAPClientFromConn(conn), nil
 }
 
-// newDAPClient creates a new Client over a TCP connection.
-// Call Close() to close the connection.
-func newDAPClient(addr string) *DAPClient {
-	fmt.Println("Connecting to server at:", addr)
-	conn, err := net.Dial("tcp", addr)
+// newStdioDAPClient starts cmd as a debug adapter that speaks DAP over its
+// standard input and output, and returns a client connected to it.
+// Call Close to close the pipes; the caller remains responsible for cmd.
+func newStdioDAPClient(cmd *exec.Cmd) (*DAPClient, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		log.Fatal("dialing:", err)
+		return nil, err
 	}
-	return newDAPClientFromConn(conn)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return newDAPClientFromConn(stdioConn{ReadCloser: stdout, WriteCloser: stdin}), nil
+}
+
+// stdioConn joins the stdout and stdin pipes of an adapter process
+// into a single connection.
+type stdioConn struct {
+	io.ReadCloser
+	io.WriteCloser
 }
 
-// newDAPClientFromConn creates a new Client with the given TCP connection.
+// Close closes both pipes.
+func (c stdioConn) Close() error {
+	werr := c.WriteCloser.Close()
+	if err := c.ReadCloser.Close(); err != nil {
+		return err
+	}
+	return werr
+}
+
+// newDAPClientFromConn creates a new Client with the given connection,
+// such as a TCP connection or the pipes of an adapter process,
+// and starts reading messages from it.
 // Call Close to close the connection.
-func newDAPClientFromConn(conn net.Conn) *DAPClient {
-	c := &DAPClient{conn: conn, reader: bufio.NewReader(conn)}
+func newDAPClientFromConn(conn io.ReadWriteCloser) *DAPClient {
+	c := &DAPClient{
+		conn:        conn,
+		reader:      bufio.NewReader(conn),
+		pending:     make(map[int]chan dap.Message),
+		subscribers: make(map[int]func(dap.EventMessage)),
+		done:        make(chan struct{}),
+	}
 	c.seq = 1 // match VS Code numbering
+	go c.readLoop()
 	return c
 }
 
 // Close closes the client connection.
+// Requests still waiting for a response fail with errClientClosed.
 func (c *DAPClient) Close() {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = errClientClosed
+	}
+	c.mu.Unlock()
 	c.conn.Close()
 }
 
+// Done returns a channel that is closed when the connection to the server is lost.
+func (c *DAPClient) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the reason the read loop exited, or nil while it is still running.
+func (c *DAPClient) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Subscribe registers fn to be called for every event sent by the server.
+// fn is called from the read loop, in the order events arrive, and must not block.
+// The returned function removes the subscription.
+func (c *DAPClient) Subscribe(fn func(dap.EventMessage)) (unsubscribe func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := c.nextSubID
+	c.nextSubID++
+	c.subscribers[id] = fn
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.subscribers, id)
+	}
+}
+
+// HandleReverseRequests registers fn to answer requests sent by the server,
+// such as runInTerminal. fn runs on its own goroutine for each request; the
+// client fills in the response header and sends the result back, or an error
+// response if fn fails. Without a handler every reverse request is rejected.
+func (c *DAPClient) HandleReverseRequests(fn func(dap.RequestMessage) (dap.ResponseMessage, error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reverseRequestHandler = fn
+}
+
+// SetTrace registers fn to be called with the JSON content of every message
+// the client sends ("send") or receives ("recv"), in wire order for each
+// direction. Passing nil turns tracing off.
+func (c *DAPClient) SetTrace(fn func(direction string, content []byte)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.trace = fn
+}
+
+func (c *DAPClient) traceMessage(direction string, content []byte) {
+	c.mu.Lock()
+	trace := c.trace
+	c.mu.Unlock()
+	if trace != nil {
+		trace(direction, content)
+	}
+}
+
+// write encodes msg and sends it to the server.
+func (c *DAPClient) write(msg dap.Message) error {
+	content, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.traceMessage("send", content)
+	return dap.WriteBaseMessage(c.conn, content)
+}
+
+// readLoop reads messages until the connection fails and dispatches them.
+func (c *DAPClient) readLoop() {
+	var err error
+	for {
+		var content []byte
+		content, err = dap.ReadBaseMessage(c.reader)
+		if err != nil {
+			break
+		}
+		c.traceMessage("recv", content)
+		msg, decodeErr := dap.DecodeProtocolMessage(content)
+		if decodeErr != nil {
+			// Adapters are free to send custom events and reverse requests
+			// that go-dap does not know about; skip them instead of giving up.
+			log.Printf("dap: skipping undecodable message: %v", decodeErr)
+			continue
+		}
+		c.dispatch(msg)
+	}
+
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = fmt.Errorf("%w: %w", errConnectionLost, err)
+	}
+	c.pending = nil
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// dispatch routes a single message read from the server.
+func (c *DAPClient) dispatch(msg dap.Message) {
+	switch m := msg.(type) {
+	case dap.ResponseMessage:
+		c.mu.Lock()
+		ch, ok := c.pending[m.GetResponse().RequestSeq]
+		delete(c.pending, m.GetResponse().RequestSeq)
+		c.mu.Unlock()
+		if !ok {
+			log.Printf("dap: dropping response to unknown request %d (%s)", m.GetResponse().RequestSeq, m.GetResponse().Command)
+			return
+		}
+		ch <- msg
+	case dap.EventMessage:
+		c.mu.Lock()
+		subscribers := make([]func(dap.EventMessage), 0, len(c.subscribers))
+		for _, fn := range c.subscribers {
+			subscribers = append(subscribers, fn)
+		}
+		c.mu.Unlock()
+		for _, fn := range subscribers {
+			fn(m)
+		}
+	case dap.RequestMessage:
+		// Answering may take a while (runInTerminal spawns a process),
+		// so don't hold up the read loop.
+		go c.answerReverseRequest(m)
+	}
+}
+
+// answerReverseRequest runs the reverse request handler and sends its response to the server.
+func (c *DAPClient) answerReverseRequest(request dap.RequestMessage) {
+	c.mu.Lock()
+	handler := c.reverseRequestHandler
+	c.mu.Unlock()
+
+	var response dap.ResponseMessage
+	err := fmt.Errorf("unsupported reverse request %q", request.GetRequest().Command)
+	if handler != nil {
+		response, err = handler(request)
+	}
+	if err != nil {
+		response = &dap.ErrorResponse{
+			Body: dap.ErrorResponseBody{Error: &dap.ErrorMessage{Format: err.Error(), ShowUser: true}},
+		}
+		response.GetResponse().Message = err.Error()
+	} else {
+		response.GetResponse().Success = true
+	}
+
+	header := response.GetResponse()
+	header.Type = "response"
+	header.Command = request.GetRequest().Command
+	header.RequestSeq = request.GetRequest().Seq
+	c.mu.Lock()
+	header.Seq = c.seq
+	c.seq++
+	c.mu.Unlock()
+
+	if err := c.write(response); err != nil {
+		log.Printf("dap: unable to answer %q reverse request: %v", header.Command, err)
+	}
+}
+
 // InitializeRequest sends an 'initialize' request.
-func (c *DAPClient) InitializeRequest() error {
+// adapterID names the kind of debug adapter, e.g. "go".
+func (c *DAPClient) InitializeRequest(ctx context.Context, adapterID string) (dap.Message, error) {
 	request := &dap.InitializeRequest{Request: *c.newRequest("initialize")}
 	request.Arguments = dap.InitializeRequestArguments{
-		AdapterID:                    "go",
+		AdapterID:                    adapterID,
 		PathFormat:                   "path",
 		LinesStartAt1:                true,
 		ColumnsStartAt1:              true,
@@ -58,26 +319,29 @@ func (c *DAPClient) InitializeRequest() error {
 		SupportsRunInTerminalRequest: true,
 		Locale:                       "en-us",
 	}
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
-func (c *DAPClient) ReadMessage() (dap.Message, error) {
-	return dap.ReadProtocolMessage(c.reader)
+// LaunchRequest sends a 'launch' request with the specified arguments.
+// The arguments are adapter specific.
+func (c *DAPClient) LaunchRequest(ctx context.Context, arguments map[string]any) (dap.Message, error) {
+	request := &dap.LaunchRequest{Request: *c.newRequest("launch")}
+	request.Arguments = toRawMessage(arguments)
+	return c.sendWithin(ctx, request, buildTimeout)
 }
 
-// LaunchRequest sends a 'launch' request with the specified args.
-func (c *DAPClient) LaunchRequest(mode, program string, stopOnEntry bool) error {
+// StartLaunchRequest sends a 'launch' request like LaunchRequest, but returns
+// as soon as it is written, with a function waiting for the response. It is
+// meant for adapters that only answer launch once configurationDone was received.
+func (c *DAPClient) StartLaunchRequest(arguments map[string]any) (func(context.Context) (dap.Message, error), error) {
 	request := &dap.LaunchRequest{Request: *c.newRequest("launch")}
-	request.Arguments = toRawMessage(map[string]any{
-		"request":     "launch",
-		"mode":        mode,
-		"program":     program,
-		"stopOnEntry": stopOnEntry,
-	})
-	return c.send(request)
+	request.Arguments = toRawMessage(arguments)
+	return c.start(request, buildTimeout)
 }
 
 func (c *DAPClient) newRequest(command string) *dap.Request {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	request := &dap.Request{}
 	request.Type = "request"
 	request.Command = command
@@ -86,8 +350,74 @@ func (c *DAPClient) newRequest(command string) *dap.Request {
 	return request
 }
 
-func (c *DAPClient) send(request dap.Message) error {
-	return dap.WriteProtocolMessage(c.conn, request)
+// send writes request to the server and waits for the matching response.
+// The returned message is either the command-specific response or a *dap.ErrorResponse.
+// Waiting is bounded by ctx and by requestTimeout; a response that arrives
+// after the caller gave up is discarded.
+func (c *DAPClient) send(ctx context.Context, request dap.RequestMessage) (dap.Message, error) {
+	return c.sendWithin(ctx, request, requestTimeout)
+}
+
+// sendWithin is like send, but waits for the response for up to timeout.
+func (c *DAPClient) sendWithin(ctx context.Context, request dap.RequestMessage, timeout time.Duration) (dap.Message, error) {
+	wait, err := c.start(request, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return wait(ctx)
+}
+
+// start writes request to the server and returns a function waiting for the
+// matching response for up to timeout.
+func (c *DAPClient) start(request dap.RequestMessage, timeout time.Duration) (func(context.Context) (dap.Message, error), error) {
+	seq := request.GetRequest().Seq
+	ch := make(chan dap.Message, 1)
+	c.mu.Lock()
+	if c.pending == nil {
+		err := c.err
+		c.mu.Unlock()
+		return nil, err
+	}
+	c.pending[seq] = ch
+	c.mu.Unlock()
+
+	if err := c.write(request); err != nil {
+		c.mu.Lock()
+		delete(c.pending, seq)
+		c.mu.Unlock()
+		return nil, err
+	}
+	return func(ctx context.Context) (dap.Message, error) {
+		return c.await(ctx, request, ch, timeout)
+	}, nil
+}
+
+// await waits for the response to request to be delivered on ch.
+func (c *DAPClient) await(ctx context.Context, request dap.RequestMessage, ch <-chan dap.Message, timeout time.Duration) (dap.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	seq := request.GetRequest().Seq
+	select {
+	case msg := <-ch:
+		return msg, nil
+	case <-c.done:
+		// The response may have raced with the connection going away.
+		select {
+		case msg := <-ch:
+			return msg, nil
+		default:
+		}
+		return nil, c.Err()
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, seq)
+		c.mu.Unlock()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("no response to %q request: %w", request.GetRequest().Command, ctx.Err())
+		}
+		return nil, ctx.Err()
+	}
 }
 
 func toRawMessage(in any) json.RawMessage {
@@ -96,7 +426,7 @@ func toRawMessage(in any) json.RawMessage {
 }
 
 // SetBreakpointsRequest sends a 'setBreakpoints' request.
-func (c *DAPClient) SetBreakpointsRequest(file string, lines []int) error {
+func (c *DAPClient) SetBreakpointsRequest(ctx context.Context, file string, lines []int) (dap.Message, error) {
 	request := &dap.SetBreakpointsRequest{Request: *c.newRequest("setBreakpoints")}
 	request.Arguments = dap.SetBreakpointsArguments{
 		Source: dap.Source{
@@ -108,11 +438,11 @@ func (c *DAPClient) SetBreakpointsRequest(file string, lines []int) error {
 	for i, l := range lines {
 		request.Arguments.Breakpoints[i].Line = l
 	}
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // SetFunctionBreakpointsRequest sends a 'setFunctionBreakpoints' request.
-func (c *DAPClient) SetFunctionBreakpointsRequest(functions []string) error {
+func (c *DAPClient) SetFunctionBreakpointsRequest(ctx context.Context, functions []string) (dap.Message, error) {
 	request := &dap.SetFunctionBreakpointsRequest{Request: *c.newRequest("setFunctionBreakpoints")}
 	request.Arguments = dap.SetFunctionBreakpointsArguments{
 		Breakpoints: make([]dap.FunctionBreakpoint, len(functions)),
@@ -120,211 +450,216 @@ func (c *DAPClient) SetFunctionBreakpointsRequest(functions []string) error {
 	for i, f := range functions {
 		request.Arguments.Breakpoints[i].Name = f
 	}
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // ConfigurationDoneRequest sends a 'configurationDone' request.
-func (c *DAPClient) ConfigurationDoneRequest() error {
+func (c *DAPClient) ConfigurationDoneRequest(ctx context.Context) (dap.Message, error) {
 	request := &dap.ConfigurationDoneRequest{Request: *c.newRequest("configurationDone")}
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // ContinueRequest sends a 'continue' request.
-func (c *DAPClient) ContinueRequest(threadID int) error {
+func (c *DAPClient) ContinueRequest(ctx context.Context, threadID int) (dap.Message, error) {
 	request := &dap.ContinueRequest{Request: *c.newRequest("continue")}
 	request.Arguments.ThreadId = threadID
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // NextRequest sends a 'next' request.
-func (c *DAPClient) NextRequest(threadID int) error {
+func (c *DAPClient) NextRequest(ctx context.Context, threadID int) (dap.Message, error) {
 	request := &dap.NextRequest{Request: *c.newRequest("next")}
 	request.Arguments.ThreadId = threadID
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // StepInRequest sends a 'stepIn' request.
-func (c *DAPClient) StepInRequest(threadID int) error {
+func (c *DAPClient) StepInRequest(ctx context.Context, threadID int) (dap.Message, error) {
 	request := &dap.StepInRequest{Request: *c.newRequest("stepIn")}
 	request.Arguments.ThreadId = threadID
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // StepOutRequest sends a 'stepOut' request.
-func (c *DAPClient) StepOutRequest(threadID int) error {
+func (c *DAPClient) StepOutRequest(ctx context.Context, threadID int) (dap.Message, error) {
 	request := &dap.StepOutRequest{Request: *c.newRequest("stepOut")}
 	request.Arguments.ThreadId = threadID
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // PauseRequest sends a 'pause' request.
-func (c *DAPClient) PauseRequest(threadID int) error {
+func (c *DAPClient) PauseRequest(ctx context.Context, threadID int) (dap.Message, error) {
 	request := &dap.PauseRequest{Request: *c.newRequest("pause")}
 	request.Arguments.ThreadId = threadID
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // ThreadsRequest sends a 'threads' request.
-func (c *DAPClient) ThreadsRequest() error {
+func (c *DAPClient) ThreadsRequest(ctx context.Context) (dap.Message, error) {
 	request := &dap.ThreadsRequest{Request: *c.newRequest("threads")}
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // StackTraceRequest sends a 'stackTrace' request.
-func (c *DAPClient) StackTraceRequest(threadID, startFrame, levels int) error {
+func (c *DAPClient) StackTraceRequest(ctx context.Context, threadID, startFrame, levels int) (dap.Message, error) {
 	request := &dap.StackTraceRequest{Request: *c.newRequest("stackTrace")}
 	request.Arguments.ThreadId = threadID
 	request.Arguments.StartFrame = startFrame
 	request.Arguments.Levels = levels
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // ScopesRequest sends a 'scopes' request.
-func (c *DAPClient) ScopesRequest(frameID int) error {
+func (c *DAPClient) ScopesRequest(ctx context.Context, frameID int) (dap.Message, error) {
 	request := &dap.ScopesRequest{Request: *c.newRequest("scopes")}
 	request.Arguments.FrameId = frameID
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // VariablesRequest sends a 'variables' request.
-func (c *DAPClient) VariablesRequest(variablesReference int) error {
+func (c *DAPClient) VariablesRequest(ctx context.Context, variablesReference int) (dap.Message, error) {
 	request := &dap.VariablesRequest{Request: *c.newRequest("variables")}
 	request.Arguments.VariablesReference = variablesReference
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // EvaluateRequest sends a 'evaluate' request.
-func (c *DAPClient) EvaluateRequest(expression string, frameID int, context string) error {
+func (c *DAPClient) EvaluateRequest(ctx context.Context, expression string, frameID int, evalContext string) (dap.Message, error) {
 	request := &dap.EvaluateRequest{Request: *c.newRequest("evaluate")}
 	request.Arguments.Expression = expression
 	request.Arguments.FrameId = frameID
-	request.Arguments.Context = context
-	return c.send(request)
+	request.Arguments.Context = evalContext
+	return c.send(ctx, request)
 }
 
 // DisconnectRequest sends a 'disconnect' request.
-func (c *DAPClient) DisconnectRequest(terminateDebuggee bool) error {
+func (c *DAPClient) DisconnectRequest(ctx context.Context, terminateDebuggee bool) (dap.Message, error) {
 	request := &dap.DisconnectRequest{Request: *c.newRequest("disconnect")}
 	request.Arguments = &dap.DisconnectArguments{
 		TerminateDebuggee: terminateDebuggee,
 	}
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // ExceptionInfoRequest sends an 'exceptionInfo' request.
-func (c *DAPClient) ExceptionInfoRequest(threadID int) error {
+func (c *DAPClient) ExceptionInfoRequest(ctx context.Context, threadID int) (dap.Message, error) {
 	request := &dap.ExceptionInfoRequest{Request: *c.newRequest("exceptionInfo")}
 	request.Arguments.ThreadId = threadID
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // SetVariableRequest sends a 'setVariable' request.
-func (c *DAPClient) SetVariableRequest(variablesRef int, name, value string) error {
+func (c *DAPClient) SetVariableRequest(ctx context.Context, variablesRef int, name, value string) (dap.Message, error) {
 	request := &dap.SetVariableRequest{Request: *c.newRequest("setVariable")}
 	request.Arguments.VariablesReference = variablesRef
 	request.Arguments.Name = name
 	request.Arguments.Value = value
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // RestartRequest sends a 'restart' request with specified arguments, if provided.
-func (c *DAPClient) RestartRequest(arguments map[string]any) error {
+func (c *DAPClient) RestartRequest(ctx context.Context, arguments map[string]any) (dap.Message, error) {
 	request := &dap.RestartRequest{Request: *c.newRequest("restart")}
 	if arguments != nil {
 		request.Arguments = toRawMessage(arguments)
 	}
-	return c.send(request)
+	return c.sendWithin(ctx, request, buildTimeout)
 }
 
 // TerminateRequest sends a 'terminate' request.
-func (c *DAPClient) TerminateRequest() error {
+func (c *DAPClient) TerminateRequest(ctx context.Context) (dap.Message, error) {
 	request := &dap.TerminateRequest{Request: *c.newRequest("terminate")}
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // StepBackRequest sends a 'stepBack' request.
-func (c *DAPClient) StepBackRequest(threadID int) error {
+func (c *DAPClient) StepBackRequest(ctx context.Context, threadID int) (dap.Message, error) {
 	request := &dap.StepBackRequest{Request: *c.newRequest("stepBack")}
 	request.Arguments.ThreadId = threadID
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // LoadedSourcesRequest sends a 'loadedSources' request.
-func (c *DAPClient) LoadedSourcesRequest() error {
+func (c *DAPClient) LoadedSourcesRequest(ctx context.Context) (dap.Message, error) {
 	request := &dap.LoadedSourcesRequest{Request: *c.newRequest("loadedSources")}
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // ModulesRequest sends a 'modules' request.
-func (c *DAPClient) ModulesRequest() error {
+func (c *DAPClient) ModulesRequest(ctx context.Context) (dap.Message, error) {
 	request := &dap.ModulesRequest{Request: *c.newRequest("modules")}
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // BreakpointLocationsRequest sends a 'breakpointLocations' request.
-func (c *DAPClient) BreakpointLocationsRequest(source string, line int) error {
+func (c *DAPClient) BreakpointLocationsRequest(ctx context.Context, source string, line int) (dap.Message, error) {
 	request := &dap.BreakpointLocationsRequest{Request: *c.newRequest("breakpointLocations")}
 	request.Arguments.Source = dap.Source{
 		Path: source,
 	}
 	request.Arguments.Line = line
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // CompletionsRequest sends a 'completions' request.
-func (c *DAPClient) CompletionsRequest(text string, column int, frameID int) error {
+func (c *DAPClient) CompletionsRequest(ctx context.Context, text string, column int, frameID int) (dap.Message, error) {
 	request := &dap.CompletionsRequest{Request: *c.newRequest("completions")}
 	request.Arguments.Text = text
 	request.Arguments.Column = column
 	request.Arguments.FrameId = frameID
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // DisassembleRequest sends a 'disassemble' request.
-func (c *DAPClient) DisassembleRequest(memoryReference string, instructionOffset, instructionCount int) error {
+func (c *DAPClient) DisassembleRequest(ctx context.Context, memoryReference string, instructionOffset, instructionCount int) (dap.Message, error) {
 	request := &dap.DisassembleRequest{Request: *c.newRequest("disassemble")}
 	request.Arguments.MemoryReference = memoryReference
 	request.Arguments.InstructionOffset = instructionOffset
 	request.Arguments.InstructionCount = instructionCount
-	return c.send(request)
+	request.Arguments.ResolveSymbols = true
+	return c.send(ctx, request)
 }
 
 // SetExceptionBreakpointsRequest sends a 'setExceptionBreakpoints' request.
-func (c *DAPClient) SetExceptionBreakpointsRequest(filters []string) error {
+func (c *DAPClient) SetExceptionBreakpointsRequest(ctx context.Context, filters []string) (dap.Message, error) {
 	request := &dap.SetExceptionBreakpointsRequest{Request: *c.newRequest("setExceptionBreakpoints")}
 	request.Arguments.Filters = filters
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // DataBreakpointInfoRequest sends a 'dataBreakpointInfo' request.
-func (c *DAPClient) DataBreakpointInfoRequest(variablesRef int, name string) error {
+func (c *DAPClient) DataBreakpointInfoRequest(ctx context.Context, variablesRef int, name string) (dap.Message, error) {
 	request := &dap.DataBreakpointInfoRequest{Request: *c.newRequest("dataBreakpointInfo")}
 	request.Arguments.VariablesReference = variablesRef
 	request.Arguments.Name = name
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // SetDataBreakpointsRequest sends a 'setDataBreakpoints' request.
-func (c *DAPClient) SetDataBreakpointsRequest(breakpoints []dap.DataBreakpoint) error {
+func (c *DAPClient) SetDataBreakpointsRequest(ctx context.Context, breakpoints []dap.DataBreakpoint) (dap.Message, error) {
 	request := &dap.SetDataBreakpointsRequest{Request: *c.newRequest("setDataBreakpoints")}
 	request.Arguments.Breakpoints = breakpoints
-	return c.send(request)
+	return c.send(ctx, request)
 }
 
 // SourceRequest sends a 'source' request.
-func (c *DAPClient) SourceRequest(sourceRef int) error {
+func (c *DAPClient) SourceRequest(ctx context.Context, sourceRef int) (dap.Message, error) {
 	request := &dap.SourceRequest{Request: *c.newRequest("source")}
 	request.Arguments.SourceReference = sourceRef
-	return c.send(request)
+	return c.send(ctx, request)
+}
+
+// AttachRequest sends an 'attach' request with the specified arguments.
+// The arguments are adapter specific.
+func (c *DAPClient) AttachRequest(ctx context.Context, arguments map[string]any) (dap.Message, error) {
+	request := &dap.AttachRequest{Request: *c.newRequest("attach")}
+	request.Arguments = toRawMessage(arguments)
+	return c.send(ctx, request)
 }
 
-// AttachRequest sends an 'attach' request.
-func (c *DAPClient) AttachRequest(mode string, processID int) error {
+// StartAttachRequest is to AttachRequest what StartLaunchRequest is to LaunchRequest.
+func (c *DAPClient) StartAttachRequest(arguments map[string]any) (func(context.Context) (dap.Message, error), error) {
 	request := &dap.AttachRequest{Request: *c.newRequest("attach")}
-	request.Arguments = toRawMessage(map[string]any{
-		"request":   "attach",
-		"mode":      mode,
-		"processId": processID,
-	})
-	return c.send(request)
+	request.Arguments = toRawMessage(arguments)
+	return c.start(request, requestTimeout)
 }
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-dap"
+)
+
+// fakeAdapter is the server half of an in-memory DAP connection.
+// Tests use it to script exactly what the adapter sends back.
+type fakeAdapter struct {
+	conn   io.ReadWriteCloser
+	reader *bufio.Reader
+	mu     sync.Mutex
+	seq    int
+}
+
+// newFakeAdapter returns a client connected to an in-memory fake adapter.
+func newFakeAdapter(t *testing.T) (*DAPClient, *fakeAdapter) {
+	t.Helper()
+	clientConn, serverConn := net.Pipe()
+	client := newDAPClientFromConn(clientConn)
+	t.Cleanup(func() {
+		client.Close()
+		serverConn.Close()
+	})
+	return client, &fakeAdapter{conn: serverConn, reader: bufio.NewReader(serverConn), seq: 1}
+}
+
+// readRequest reads the next request sent by the client.
+func (f *fakeAdapter) readRequest(t *testing.T) dap.RequestMessage {
+	t.Helper()
+	msg, err := dap.ReadProtocolMessage(f.reader)
+	if err != nil {
+		t.Errorf("fake adapter: reading request: %v", err)
+		return nil
+	}
+	req, ok := msg.(dap.RequestMessage)
+	if !ok {
+		t.Errorf("fake adapter: expected request, got %T", msg)
+		return nil
+	}
+	return req
+}
+
+// write sends msg to the client, filling in its sequence number.
+func (f *fakeAdapter) write(t *testing.T, msg dap.Message) {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch m := msg.(type) {
+	case dap.ResponseMessage:
+		m.GetResponse().Seq = f.seq
+	case dap.EventMessage:
+		m.GetEvent().Seq = f.seq
+	case dap.RequestMessage:
+		m.GetRequest().Seq = f.seq
+	}
+	f.seq++
+	if err := dap.WriteProtocolMessage(f.conn, msg); err != nil {
+		t.Errorf("fake adapter: writing %T: %v", msg, err)
+	}
+}
+
+// newResponse returns a successful response header for req.
+func newResponse(req dap.RequestMessage) dap.Response {
+	return dap.Response{
+		ProtocolMessage: dap.ProtocolMessage{Type: "response"},
+		Command:         req.GetRequest().Command,
+		RequestSeq:      req.GetRequest().Seq,
+		Success:         true,
+	}
+}
+
+// newEvent returns an event header for the named event.
+func newEvent(event string) dap.Event {
+	return dap.Event{ProtocolMessage: dap.ProtocolMessage{Type: "event"}, Event: event}
+}
+
+func TestDAPClientRoutesEventsAndResponses(t *testing.T) {
+	client, adapter := newFakeAdapter(t)
+
+	events := make(chan dap.EventMessage, 10)
+	unsubscribe := client.Subscribe(func(e dap.EventMessage) { events <- e })
+	defer unsubscribe()
+
+	go func() {
+		req := adapter.readRequest(t)
+		if req == nil {
+			return
+		}
+		// An event sent before the response must not be mistaken for it.
+		adapter.write(t, &dap.OutputEvent{Event: newEvent("output"), Body: dap.OutputEventBody{Category: "stdout", Output: "hi\n"}})
+		adapter.write(t, &dap.ThreadsResponse{
+			Response: newResponse(req),
+			Body:     dap.ThreadsResponseBody{Threads: []dap.Thread{{Id: 1, Name: "main"}}},
+		})
+	}()
+
+	msg, err := client.ThreadsRequest(context.Background())
+	if err != nil {
+		t.Fatalf("ThreadsRequest: %v", err)
+	}
+	resp, ok := msg.(*dap.ThreadsResponse)
+	if !ok {
+		t.Fatalf("expected *dap.ThreadsResponse, got %T", msg)
+	}
+	if len(resp.Body.Threads) != 1 || resp.Body.Threads[0].Name != "main" {
+		t.Errorf("unexpected threads: %+v", resp.Body.Threads)
+	}
+
+	select {
+	case e := <-events:
+		if out, ok := e.(*dap.OutputEvent); !ok || out.Body.Output != "hi\n" {
+			t.Errorf("unexpected event: %#v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("output event was not delivered to subscriber")
+	}
+}
+
+func TestDAPClientOutOfOrderResponses(t *testing.T) {
+	client, adapter := newFakeAdapter(t)
+
+	go func() {
+		first := adapter.readRequest(t)
+		second := adapter.readRequest(t)
+		if first == nil || second == nil {
+			return
+		}
+		// Answer in the opposite order the requests were sent.
+		for _, req := range []dap.RequestMessage{second, first} {
+			adapter.write(t, &dap.EvaluateResponse{
+				Response: newResponse(req),
+				Body:     dap.EvaluateResponseBody{Result: req.(*dap.EvaluateRequest).Arguments.Expression},
+			})
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, expr := range []string{"a", "b"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			msg, err := client.EvaluateRequest(context.Background(), expr, 0, "repl")
+			if err != nil {
+				t.Errorf("EvaluateRequest(%q): %v", expr, err)
+				return
+			}
+			if got := msg.(*dap.EvaluateResponse).Body.Result; got != expr {
+				t.Errorf("EvaluateRequest(%q) got response for %q", expr, got)
+			}
+		}()
+		// Make sure both requests are in flight before the adapter answers.
+		time.Sleep(10 * time.Millisecond)
+	}
+	wg.Wait()
+}
+
+func TestDAPClientConnectionLost(t *testing.T) {
+	client, adapter := newFakeAdapter(t)
+
+	go func() {
+		adapter.readRequest(t)
+		adapter.conn.Close()
+	}()
+
+	if _, err := client.ThreadsRequest(context.Background()); err == nil {
+		t.Fatal("expected an error when the adapter goes away")
+	}
+	select {
+	case <-client.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done was not closed after the connection was lost")
+	}
+}
+
+func TestDAPClientRequestCancelled(t *testing.T) {
+	client, adapter := newFakeAdapter(t)
+
+	late := make(chan dap.RequestMessage, 1)
+	go func() {
+		late <- adapter.readRequest(t)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.ThreadsRequest(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	// The late response must be discarded and the client must stay usable.
+	go func() {
+		if req := <-late; req != nil {
+			adapter.write(t, &dap.ThreadsResponse{Response: newResponse(req)})
+		}
+		req := adapter.readRequest(t)
+		if req == nil {
+			return
+		}
+		adapter.write(t, &dap.EvaluateResponse{Response: newResponse(req), Body: dap.EvaluateResponseBody{Result: "42"}})
+	}()
+	msg, err := client.EvaluateRequest(context.Background(), "x", 0, "repl")
+	if err != nil {
+		t.Fatalf("EvaluateRequest after timeout: %v", err)
+	}
+	if resp, ok := msg.(*dap.EvaluateResponse); !ok || resp.Body.Result != "42" {
+		t.Errorf("unexpected response after timeout: %#v", msg)
+	}
+}
+
+func TestDAPClientLaunchWaitsForBuild(t *testing.T) {
+	defer func(timeout time.Duration) { requestTimeout = timeout }(requestTimeout)
+	requestTimeout = 20 * time.Millisecond
+	client, adapter := newFakeAdapter(t)
+
+	go func() {
+		req := adapter.readRequest(t)
+		if req == nil {
+			return
+		}
+		// Building the program takes longer than other requests may wait.
+		time.Sleep(100 * time.Millisecond)
+		adapter.write(t, &dap.LaunchResponse{Response: newResponse(req)})
+	}()
+	msg, err := client.LaunchRequest(context.Background(), map[string]any{"program": "."})
+	if err != nil {
+		t.Fatalf("LaunchRequest: %v", err)
+	}
+	if _, ok := msg.(*dap.LaunchResponse); !ok {
+		t.Errorf("expected *dap.LaunchResponse, got %#v", msg)
+	}
+}
+
+// TestHelperStdioAdapter is not a real test: when run as a child process by
+// TestStdioDAPClient it behaves as a minimal debug adapter speaking DAP over
+// stdin/stdout. If MCP_DAP_HELPER_LISTEN is set, it listens on that TCP
+// address instead, announcing it on stdout the way dlv does.
+func TestHelperStdioAdapter(t *testing.T) {
+	if os.Getenv("MCP_DAP_HELPER_ADAPTER") != "1" {
+		t.Skip("helper process")
+	}
+	var conn io.ReadWriteCloser = stdioConn{ReadCloser: os.Stdin, WriteCloser: os.Stdout}
+	if addr := os.Getenv("MCP_DAP_HELPER_LISTEN"); addr != "" {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "helper:", err)
+			os.Exit(1)
+		}
+		fmt.Println("DAP server listening at:", l.Addr())
+		if conn, err = l.Accept(); err != nil {
+			os.Exit(1)
+		}
+	}
+	adapter := &fakeAdapter{conn: conn, reader: bufio.NewReader(conn), seq: 1}
+	for {
+		msg, err := dap.ReadProtocolMessage(adapter.reader)
+		if err != nil {
+			os.Exit(0)
+		}
+		switch req := msg.(type) {
+		case *dap.InitializeRequest:
+			adapter.write(t, &dap.InitializeResponse{
+				Response: newResponse(req),
+				Body:     dap.Capabilities{SupportsConfigurationDoneRequest: true},
+			})
+			adapter.write(t, &dap.InitializedEvent{Event: newEvent("initialized")})
+		case *dap.DisconnectRequest:
+			adapter.write(t, &dap.DisconnectResponse{Response: newResponse(req)})
+			os.Exit(0)
+		}
+	}
+}
+
+func TestStdioDAPClient(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperStdioAdapter$")
+	cmd.Env = append(os.Environ(), "MCP_DAP_HELPER_ADAPTER=1")
+	client, err := newStdioDAPClient(cmd)
+	if err != nil {
+		t.Fatalf("starting stdio adapter: %v", err)
+	}
+	defer func() {
+		client.Close()
+		cmd.Wait()
+	}()
+
+	initialized := make(chan struct{}, 1)
+	client.Subscribe(func(e dap.EventMessage) {
+		if _, ok := e.(*dap.InitializedEvent); ok {
+			initialized <- struct{}{}
+		}
+	})
+
+	msg, err := client.InitializeRequest(context.Background(), "go")
+	if err != nil {
+		t.Fatalf("InitializeRequest: %v", err)
+	}
+	resp, ok := msg.(*dap.InitializeResponse)
+	if !ok || !resp.Body.SupportsConfigurationDoneRequest {
+		t.Fatalf("unexpected initialize response: %#v", msg)
+	}
+	select {
+	case <-initialized:
+	case <-time.After(5 * time.Second):
+		t.Fatal("initialized event was not received")
+	}
+
+	if msg, err := client.DisconnectRequest(context.Background(), true); err != nil {
+		t.Fatalf("DisconnectRequest: %v", err)
+	} else if _, ok := msg.(*dap.DisconnectResponse); !ok {
+		t.Fatalf("unexpected disconnect response: %#v", msg)
+	}
+}
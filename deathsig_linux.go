@@ -0,0 +1,10 @@
+package main
+
+import "syscall"
+
+// setDeathSignal has the kernel send SIGKILL to the process when the thread
+// of the server that started it exits, as it does when the server is killed.
+// Only that process is killed: its own children are left to it.
+func setDeathSignal(attr *syscall.SysProcAttr) {
+	attr.Pdeathsig = syscall.SIGKILL
+}
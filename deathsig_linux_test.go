@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestAdapterDiesWithServer(t *testing.T) {
+	// The helper plays the server and starts an adapter.
+	server := exec.Command(os.Args[0], "-test.run=^TestHelperServer$")
+	server.Env = append(os.Environ(), "MCP_DAP_HELPER_SERVER=1")
+	stdout, err := server.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		server.Process.Kill()
+		t.Fatal(err)
+	}
+	adapter, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		server.Process.Kill()
+		t.Fatalf("unexpected adapter PID %q", line)
+	}
+
+	// The server gets no chance to kill the adapter.
+	server.Process.Kill()
+	server.Wait()
+	deadline := time.Now().Add(5 * time.Second)
+	for !exited(adapter) {
+		if time.Now().After(deadline) {
+			syscall.Kill(adapter, syscall.SIGKILL)
+			t.Fatal("the adapter outlived the server")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestHelperServer is not a real test: when run as a child process by
+// TestAdapterDiesWithServer it starts a long running adapter, prints its PID
+// and waits to be killed.
+func TestHelperServer(t *testing.T) {
+	if os.Getenv("MCP_DAP_HELPER_SERVER") != "1" {
+		t.Skip("helper process")
+	}
+	cmd := exec.Command("sleep", "300")
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintln(os.Stderr, "helper:", err)
+		os.Exit(1)
+	}
+	fmt.Println(cmd.Process.Pid)
+	time.Sleep(time.Minute)
+	os.Exit(0)
+}
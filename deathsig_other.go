@@ -0,0 +1,9 @@
+//go:build unix && !linux
+
+package main
+
+import "syscall"
+
+// setDeathSignal does nothing: only Linux can kill a process when its parent
+// dies. Elsewhere, adapters outlive a server that is killed with SIGKILL.
+func setDeathSignal(attr *syscall.SysProcAttr) {}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/google/go-dap"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// errNotStarted is returned by tools that need a debugger session when none is running.
+var errNotStarted = errors.New("debugger not started")
+
+// Kinds of tool failures, reported in the kind field of a toolError so that
+// clients can tell a request the adapter rejected from an adapter that is gone.
+const (
+	// errorKindRequest means the adapter answered the request with an error,
+	// e.g. because of an unknown thread ID or an invalid expression.
+	errorKindRequest = "request"
+	// errorKindUnsupported means the adapter does not support the request.
+	errorKindUnsupported = "unsupported"
+	// errorKindReadOnly means the tool cannot be used in a session debugging a core file.
+	errorKindReadOnly = "readOnly"
+	// errorKindState means the tool cannot be used in the current state of
+	// the session, e.g. stepping while the program is running.
+	errorKindState = "state"
+	// errorKindBusy means another tool call is using the session.
+	errorKindBusy = "busy"
+	// errorKindNotStarted means no debugger session is running.
+	errorKindNotStarted = "notStarted"
+	// errorKindTimeout means the adapter did not answer in time.
+	errorKindTimeout = "timeout"
+	// errorKindConnection means the connection to the adapter was closed or lost.
+	errorKindConnection = "connection"
+	// errorKindProtocol means the adapter sent a message the server did not expect.
+	errorKindProtocol = "protocol"
+	// errorKindInternal covers every other failure.
+	errorKindInternal = "internal"
+)
+
+// toolError is the structured content of a failed tool call.
+// For errors reported by the adapter it carries the fields of the DAP ErrorResponse.
+type toolError struct {
+	Kind string `json:"kind"`
+	// Error is the complete error message, as also given in the text content.
+	Error string `json:"error"`
+	// Command is the DAP request that failed, if any.
+	Command string `json:"command,omitempty"`
+	// Message is the short, machine readable message of the DAP response.
+	Message string `json:"message,omitempty"`
+	// The remaining fields are copied from the error message in the body of the DAP response.
+	ID        int               `json:"id,omitempty"`
+	Format    string            `json:"format,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
+	ShowUser  bool              `json:"showUser,omitempty"`
+	URL       string            `json:"url,omitempty"`
+	URLLabel  string            `json:"urlLabel,omitempty"`
+}
+
+// DAPError is returned when the adapter fails a request or answers it
+// with an unexpected message.
+type DAPError struct {
+	// Op describes what the tool was trying to do, e.g. "unable to get stack trace".
+	Op string
+	// Kind is errorKindRequest or errorKindProtocol.
+	Kind    string
+	Command string
+	// Message is the message of the response, or a description of the unexpected message.
+	Message string
+	// Details is the error message in the body of an ErrorResponse, if any.
+	Details *dap.ErrorMessage
+}
+
+func (e *DAPError) Error() string {
+	text := e.Message
+	if e.Details != nil && e.Details.Format != "" {
+		text = formatErrorMessage(e.Details.Format, e.Details.Variables)
+	}
+	if text == "" {
+		text = "request failed"
+	}
+	return e.Op + ": " + text
+}
+
+// errorVariable matches the {name} placeholders of a DAP error message format.
+var errorVariable = regexp.MustCompile(`\{([^}]*)\}`)
+
+// formatErrorMessage fills in the {name} placeholders of a DAP error message format.
+// Placeholders without a value are left as is.
+func formatErrorMessage(format string, variables map[string]string) string {
+	return errorVariable.ReplaceAllStringFunc(format, func(placeholder string) string {
+		if value, ok := variables[placeholder[1:len(placeholder)-1]]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// validateResponse validates the response to a DAP request.
+// It returns a *DAPError if the request failed or msg is not a response.
+func validateResponse(msg dap.Message, errorPrefix string) error {
+	resp, ok := msg.(dap.ResponseMessage)
+	if !ok {
+		return unexpectedResponse(msg, errorPrefix)
+	}
+	if resp.GetResponse().Success {
+		return nil
+	}
+	err := &DAPError{
+		Op:      errorPrefix,
+		Kind:    errorKindRequest,
+		Command: resp.GetResponse().Command,
+		Message: resp.GetResponse().Message,
+	}
+	if errResp, ok := msg.(*dap.ErrorResponse); ok {
+		err.Details = errResp.Body.Error
+	}
+	return err
+}
+
+// unexpectedResponse returns the error for a successful response
+// that is not of the type the request calls for.
+func unexpectedResponse(msg dap.Message, errorPrefix string) error {
+	err := &DAPError{Op: errorPrefix, Kind: errorKindProtocol, Message: fmt.Sprintf("unexpected response type: %T", msg)}
+	if resp, ok := msg.(dap.ResponseMessage); ok {
+		err.Command = resp.GetResponse().Command
+	}
+	return err
+}
+
+// newToolError classifies err and returns its structured description.
+func newToolError(err error) toolError {
+	te := toolError{Kind: errorKindInternal, Error: err.Error()}
+	var dapErr *DAPError
+	switch {
+	case errors.As(err, &dapErr):
+		te.Kind = dapErr.Kind
+		te.Command = dapErr.Command
+		te.Message = dapErr.Message
+		if d := dapErr.Details; d != nil {
+			te.ID = d.Id
+			te.Format = d.Format
+			te.Variables = d.Variables
+			te.ShowUser = d.ShowUser
+			te.URL = d.Url
+			te.URLLabel = d.UrlLabel
+		}
+	case errors.Is(err, errNotSupported):
+		te.Kind = errorKindUnsupported
+	case errors.Is(err, errReadOnly):
+		te.Kind = errorKindReadOnly
+	case errors.Is(err, errInvalidState):
+		te.Kind = errorKindState
+	case errors.Is(err, errSessionBusy):
+		te.Kind = errorKindBusy
+	case errors.Is(err, errNotStarted):
+		te.Kind = errorKindNotStarted
+	case errors.Is(err, context.DeadlineExceeded):
+		te.Kind = errorKindTimeout
+	case errors.Is(err, errClientClosed), errors.Is(err, errConnectionLost):
+		te.Kind = errorKindConnection
+	}
+	return te
+}
+
+// errorResult reports err as a tool result with IsError set and a
+// toolError as its structured content.
+func errorResult(err error) *mcp.CallToolResultFor[any] {
+	return &mcp.CallToolResultFor[any]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		StructuredContent: newToolError(err),
+		IsError:           true,
+	}
+}
+
+// addTool registers a tool with the server. Errors returned by h are
+// reported with errorResult, so clients get structured error details
+// instead of bare text.
+func addTool[In any](server *mcp.Server, tool *mcp.Tool, h mcp.ToolHandlerFor[In, any]) {
+	mcp.AddTool(server, tool, func(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[In]) (*mcp.CallToolResultFor[any], error) {
+		result, err := h(ctx, ss, params)
+		if err != nil {
+			return errorResult(err), nil
+		}
+		return result, nil
+	})
+}
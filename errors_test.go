@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-dap"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestErrorResponseResult(t *testing.T) {
+	client, adapter := newFakeAdapter(t)
+	go func() {
+		req := adapter.readRequest(t)
+		if req == nil {
+			return
+		}
+		resp := &dap.ErrorResponse{Response: newResponse(req)}
+		resp.Success = false
+		resp.Message = "Unable to produce stack trace"
+		resp.Body.Error = &dap.ErrorMessage{
+			Id:        2004,
+			Format:    "Unable to produce stack trace: unknown goroutine {id}",
+			Variables: map[string]string{"id": "42"},
+			ShowUser:  true,
+		}
+		adapter.write(t, resp)
+	}()
+
+	ds := &debuggerSession{client: client, status: sessionStatus{state: stateStopped}}
+	_, err := ds.getStackTrace(context.Background(), nil, &mcp.CallToolParamsFor[StackTraceParams]{Arguments: StackTraceParams{ThreadID: 42}})
+	if err == nil {
+		t.Fatal("expected an error for an unknown thread")
+	}
+	if want := "unable to get stack trace: Unable to produce stack trace: unknown goroutine 42"; err.Error() != want {
+		t.Errorf("got error %q, want %q", err, want)
+	}
+
+	result := errorResult(err)
+	if !result.IsError {
+		t.Error("IsError not set")
+	}
+	te, ok := result.StructuredContent.(toolError)
+	if !ok {
+		t.Fatalf("unexpected structured content %#v", result.StructuredContent)
+	}
+	if te.Kind != errorKindRequest || te.Command != "stackTrace" || te.ID != 2004 || !te.ShowUser || te.Variables["id"] != "42" {
+		t.Errorf("unexpected tool error %+v", te)
+	}
+}
+
+func TestToolErrorKinds(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		kind string
+	}{
+		{errNotStarted, errorKindNotStarted},
+		{fmt.Errorf("continue is %w", errReadOnly), errorKindReadOnly},
+		{fmt.Errorf("step-in is %w (running)", errInvalidState), errorKindState},
+		{fmt.Errorf("%w: continue is in progress", errSessionBusy), errorKindBusy},
+		{fmt.Errorf("disassemble request is %w", errNotSupported), errorKindUnsupported},
+		{fmt.Errorf("no response to %q request: %w", "threads", context.DeadlineExceeded), errorKindTimeout},
+		{fmt.Errorf("%w: EOF", errConnectionLost), errorKindConnection},
+		{errClientClosed, errorKindConnection},
+		{unexpectedResponse(&dap.ThreadsResponse{}, "unable to evaluate expression"), errorKindProtocol},
+		{fmt.Errorf("invalid grep pattern"), errorKindInternal},
+	} {
+		if got := newToolError(tt.err).Kind; got != tt.kind {
+			t.Errorf("newToolError(%q).Kind = %q, want %q", tt.err, got, tt.kind)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/go-dap"
+)
+
+// defaultJournalSize is the number of events kept by an eventJournal.
+const defaultJournalSize = 1000
+
+// journalEntry is a single DAP event recorded by an eventJournal.
+type journalEntry struct {
+	// Seq is assigned by the journal, starting at 1, and is
+	// used as the cursor when polling for new events.
+	Seq   int
+	Time  time.Time
+	Event dap.EventMessage
+}
+
+// Type returns the DAP event type, e.g. "stopped" or "output".
+func (e journalEntry) Type() string {
+	return e.Event.GetEvent().Event
+}
+
+// Body returns the JSON encoding of the event body, or nil if the event has none.
+func (e journalEntry) Body() json.RawMessage {
+	b, err := json.Marshal(e.Event)
+	if err != nil {
+		return nil
+	}
+	var event struct {
+		Body json.RawMessage `json:"body"`
+	}
+	if err := json.Unmarshal(b, &event); err != nil {
+		return nil
+	}
+	return event.Body
+}
+
+// eventJournal is a bounded ring buffer of the events received during a
+// debugger session. Once full, the oldest events are discarded.
+type eventJournal struct {
+	mu      sync.Mutex
+	entries []journalEntry
+	// start is the index of the oldest entry in entries.
+	start int
+	// nextSeq is the sequence number given to the next recorded event.
+	nextSeq int
+}
+
+// newEventJournal creates a journal that keeps up to size events.
+func newEventJournal(size int) *eventJournal {
+	return &eventJournal{
+		entries: make([]journalEntry, 0, size),
+		nextSeq: 1,
+	}
+}
+
+// record adds event to the journal. It has the signature expected by
+// DAPClient.Subscribe.
+func (j *eventJournal) record(event dap.EventMessage) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry := journalEntry{Seq: j.nextSeq, Time: time.Now(), Event: event}
+	j.nextSeq++
+	if len(j.entries) < cap(j.entries) {
+		j.entries = append(j.entries, entry)
+		return
+	}
+	j.entries[j.start] = entry
+	j.start = (j.start + 1) % len(j.entries)
+}
+
+// since returns up to limit events with a sequence number greater than cursor,
+// oldest first, optionally restricted to the given event types.
+// It also returns the cursor to pass on the next call and the number of
+// events after cursor that were discarded before they could be read.
+func (j *eventJournal) since(cursor int, types []string, limit int) (entries []journalEntry, next int, dropped int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	next = cursor
+	for i := range j.entries {
+		entry := j.entries[(j.start+i)%len(j.entries)]
+		if i == 0 && entry.Seq > cursor+1 {
+			dropped = entry.Seq - cursor - 1
+		}
+		if entry.Seq <= cursor {
+			continue
+		}
+		if limit > 0 && len(entries) == limit {
+			break
+		}
+		next = entry.Seq
+		if len(types) > 0 && !slices.Contains(types, entry.Type()) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, next, dropped
+}
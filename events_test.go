@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-dap"
+)
+
+func TestEventJournal(t *testing.T) {
+	j := newEventJournal(3)
+	for _, name := range []string{"output", "stopped", "output", "thread"} {
+		j.record(&dap.Event{ProtocolMessage: dap.ProtocolMessage{Type: "event"}, Event: name})
+	}
+
+	// The first event fell out of the ring buffer.
+	entries, next, dropped := j.since(0, nil, 0)
+	if dropped != 1 {
+		t.Errorf("expected 1 dropped event, got %d", dropped)
+	}
+	if len(entries) != 3 || entries[0].Seq != 2 || entries[2].Seq != 4 {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	if next != 4 {
+		t.Errorf("expected next cursor 4, got %d", next)
+	}
+
+	// Filtering by type still advances the cursor past skipped events.
+	entries, next, _ = j.since(1, []string{"output"}, 0)
+	if len(entries) != 1 || entries[0].Seq != 3 || entries[0].Type() != "output" {
+		t.Fatalf("unexpected filtered entries: %+v", entries)
+	}
+	if next != 4 {
+		t.Errorf("expected next cursor 4, got %d", next)
+	}
+
+	// The limit caps the number of returned events.
+	entries, next, _ = j.since(1, nil, 1)
+	if len(entries) != 1 || next != 2 {
+		t.Errorf("expected one event and cursor 2, got %d events and cursor %d", len(entries), next)
+	}
+
+	// Nothing new after the latest cursor.
+	if entries, next, _ = j.since(4, nil, 0); len(entries) != 0 || next != 4 {
+		t.Errorf("expected no events after cursor 4, got %+v (next %d)", entries, next)
+	}
+}
@@ -2,9 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
@@ -16,7 +20,12 @@ func main() {
 		Version: "v1.0.0",
 	}
 	server := mcp.NewServer(&implementation, nil)
-	registerTools(server)
+	sessions := registerTools(server)
+
+	// Stop every debugger, and the programs they run, before exiting on SIGINT or SIGTERM.
+	// Adapters run in process groups of their own, so they do not get the signal themselves.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Check transport mode from environment variable
 	transportMode := os.Getenv("MCP_TRANSPORT")
@@ -28,11 +37,14 @@ func main() {
 	case "stdio":
 		log.Println("Starting MCP server with stdio transport")
 		stdioTransport := mcp.NewStdioTransport()
-		err := server.Run(context.Background(), stdioTransport)
-		if err != nil {
+		err := server.Run(ctx, stdioTransport)
+		sessions.shutdown()
+		if err != nil && ctx.Err() == nil {
 			log.Fatalf("Failed to serve stdio: %v", err)
 		}
 	case "sse":
+		// Every client shares the server, but registerTools gives each
+		// client session a debugger of its own.
 		getServer := func(request *http.Request) *mcp.Server {
 			return server
 		}
@@ -45,11 +57,33 @@ func main() {
 		}
 
 		log.Printf("Starting MCP server with SSE transport on port :%s", port)
-		err := http.ListenAndServe(":"+port, sseHandler)
-		if err != nil {
+		httpServer := &http.Server{Addr: ":" + port, Handler: sseHandler}
+		go func() {
+			<-ctx.Done()
+			// The SSE streams never finish on their own, so don't wait for them.
+			httpServer.Close()
+		}()
+		err := httpServer.ListenAndServe()
+		sessions.shutdown()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("Failed to serve SSE: %v", err)
 		}
 	default:
 		log.Fatalf("Unknown transport mode: %s. Supported modes: stdio, sse", transportMode)
 	}
 }
+
+// durationFromEnv parses the environment variable key as a time.Duration,
+// returning def if it is unset or invalid.
+func durationFromEnv(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("Ignoring invalid %s=%q, using %s", key, v, def)
+		return def
+	}
+	return d
+}
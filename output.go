@@ -0,0 +1,108 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/go-dap"
+)
+
+// defaultOutputSize is the number of output chunks kept by an outputBuffer.
+const defaultOutputSize = 5000
+
+// outputEntry is a chunk of text written by the debuggee or the debug adapter.
+type outputEntry struct {
+	// Seq is assigned by the buffer, starting at 1, and is
+	// used as the cursor when polling for new output.
+	Seq  int
+	Time time.Time
+	// Category is the DAP output category (stdout, stderr, console, important, ...),
+	// or "adapter" for text the debug adapter process wrote to its own stderr.
+	Category string
+	Output   string
+	// Source and Line locate the code that produced the output, when the adapter reports it.
+	Source string
+	Line   int
+}
+
+// outputBuffer keeps the most recent output of a debugger session.
+type outputBuffer struct {
+	mu      sync.Mutex
+	entries []outputEntry
+	size    int
+	nextSeq int
+}
+
+// newOutputBuffer creates a buffer that keeps up to size output chunks.
+func newOutputBuffer(size int) *outputBuffer {
+	return &outputBuffer{size: size, nextSeq: 1}
+}
+
+// write appends a chunk of output to the buffer, discarding the oldest
+// chunks once the buffer is full.
+func (b *outputBuffer) write(category, output, source string, line int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries = append(b.entries, outputEntry{
+		Seq:      b.nextSeq,
+		Time:     time.Now(),
+		Category: category,
+		Output:   output,
+		Source:   source,
+		Line:     line,
+	})
+	b.nextSeq++
+	// Trim in batches so that a full buffer does not copy on every write.
+	if len(b.entries) >= 2*b.size {
+		b.entries = append(b.entries[:0], b.entries[len(b.entries)-b.size:]...)
+	}
+}
+
+// recordEvent stores the text of OutputEvents. It has the signature expected
+// by DAPClient.Subscribe and ignores every other event.
+func (b *outputBuffer) recordEvent(event dap.EventMessage) {
+	out, ok := event.(*dap.OutputEvent)
+	if !ok || out.Body.Category == "telemetry" {
+		return
+	}
+	category := out.Body.Category
+	if category == "" {
+		// The DAP specification says a missing category means console.
+		category = "console"
+	}
+	var source string
+	if out.Body.Source != nil {
+		source = out.Body.Source.Path
+	}
+	b.write(category, out.Body.Output, source, out.Body.Line)
+}
+
+// writer returns an io.Writer that records everything written to it under category.
+func (b *outputBuffer) writer(category string) *outputWriter {
+	return &outputWriter{buf: b, category: category}
+}
+
+// since returns the retained output chunks with a sequence number greater than cursor,
+// oldest first, for which keep returns true, along with the cursor to pass on the next call.
+func (b *outputBuffer) since(cursor int, keep func(outputEntry) bool) (entries []outputEntry, next int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	start := max(0, len(b.entries)-b.size)
+	for _, entry := range b.entries[start:] {
+		if entry.Seq > cursor && keep(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, max(cursor, b.nextSeq-1)
+}
+
+// outputWriter adapts an outputBuffer to io.Writer.
+type outputWriter struct {
+	buf      *outputBuffer
+	category string
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	w.buf.write(w.category, string(p), "", 0)
+	return len(p), nil
+}
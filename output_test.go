@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-dap"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestProgramOutput(t *testing.T) {
+	ds := &debuggerSession{output: newOutputBuffer(defaultOutputSize)}
+	output := func(category, text string) *dap.OutputEvent {
+		return &dap.OutputEvent{Event: newEvent("output"), Body: dap.OutputEventBody{Category: category, Output: text}}
+	}
+	ds.output.recordEvent(output("stdout", "starting\nlistening on :8080\n"))
+	ds.output.recordEvent(output("stderr", "panic: boom\n"))
+	ds.output.recordEvent(output("telemetry", "ignored\n"))
+	ds.output.writer("adapter").Write([]byte("DAP server listening at: 127.0.0.1:1234\n"))
+
+	call := func(args ProgramOutputParams) string {
+		t.Helper()
+		res, err := ds.programOutput(context.Background(), nil, &mcp.CallToolParamsFor[ProgramOutputParams]{Arguments: args})
+		if err != nil {
+			t.Fatalf("programOutput(%+v): %v", args, err)
+		}
+		return res.Content[0].(*mcp.TextContent).Text
+	}
+
+	all := call(ProgramOutputParams{})
+	for _, want := range []string{"[stdout] starting", "[stdout] listening on :8080", "[stderr] panic: boom", "Next cursor: 3"} {
+		if !strings.Contains(all, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, all)
+		}
+	}
+	if strings.Contains(all, "ignored") || strings.Contains(all, "DAP server listening") {
+		t.Errorf("telemetry and adapter output should be excluded by default, got:\n%s", all)
+	}
+
+	if got := call(ProgramOutputParams{Grep: "listen"}); !strings.Contains(got, "[stdout] listening on :8080") || strings.Contains(got, "starting") {
+		t.Errorf("grep did not filter lines, got:\n%s", got)
+	}
+	if got := call(ProgramOutputParams{Tail: 1}); !strings.Contains(got, "panic: boom") || strings.Contains(got, "starting") {
+		t.Errorf("tail did not keep only the last line, got:\n%s", got)
+	}
+	if got := call(ProgramOutputParams{Categories: []string{"adapter"}}); !strings.Contains(got, "[adapter] DAP server listening") {
+		t.Errorf("expected adapter output when requested, got:\n%s", got)
+	}
+	if got := call(ProgramOutputParams{Since: 3}); !strings.Contains(got, "No new output.") {
+		t.Errorf("expected no output after the last cursor, got:\n%s", got)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import "os/exec"
+
+// setProcessGroup does nothing: process groups are only supported on Unix.
+// Adapters also outlive a server that is killed without a chance to clean up.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the started command cmd.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,31 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes cmd start in a process group of its own, so that
+// it and everything it starts can be killed together with killProcessGroup.
+// Where the platform allows it, cmd is also killed when the server dies
+// without a chance to clean up; see setDeathSignal.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	setDeathSignal(cmd.SysProcAttr)
+}
+
+// killProcessGroup kills the process group led by the started command cmd.
+func killProcessGroup(cmd *exec.Cmd) error {
+	err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	if errors.Is(err, syscall.ESRCH) {
+		// The group is gone, or cmd does not lead one.
+		return cmd.Process.Kill()
+	}
+	return err
+}
@@ -0,0 +1,63 @@
+//go:build unix
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestKillAdapterKillsProcessGroup(t *testing.T) {
+	// The adapter starts a child, as dlv starts the program it debugs.
+	cmd := exec.Command("sh", "-c", "sleep 300 & echo $!; wait")
+	setProcessGroup(cmd)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		t.Fatalf("unexpected child PID %q", line)
+	}
+
+	ds := &debuggerSession{cmd: cmd}
+	if err := ds.killAdapter(); err != nil {
+		t.Fatalf("killAdapter: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !exited(child) {
+		if time.Now().After(deadline) {
+			syscall.Kill(child, syscall.SIGKILL)
+			t.Fatal("the child of the adapter outlived it")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// exited reports whether the process pid is gone or a zombie.
+func exited(pid int) bool {
+	if err := syscall.Kill(pid, 0); errors.Is(err, syscall.ESRCH) {
+		return true
+	}
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return false
+	}
+	// The state follows the command name, which is in parentheses.
+	_, state, _ := strings.Cut(string(stat), ") ")
+	return strings.HasPrefix(state, "Z")
+}
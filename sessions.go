@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// sessionManager holds the debugger sessions of each connected MCP client,
+// so that clients sharing the server do not drive each other's debuggers.
+type sessionManager struct {
+	mu      sync.Mutex
+	clients map[*mcp.ServerSession]*clientSessions
+	// shuttingDown is set once shutdown began; no sessions may be created then.
+	shuttingDown bool
+	// closing counts the clients whose debuggers are being stopped
+	// and the tool calls creating a session.
+	closing sync.WaitGroup
+}
+
+func newSessionManager() *sessionManager {
+	return &sessionManager{clients: make(map[*mcp.ServerSession]*clientSessions)}
+}
+
+// clientSessions holds the debugger sessions of one MCP client.
+type clientSessions struct {
+	mu sync.Mutex
+	// closed is set once the client is gone; no sessions may be added then.
+	closed bool
+	// sessions is ordered from the least to the most recently used session,
+	// which tools use when no session ID is given.
+	sessions []*debuggerSession
+}
+
+// client returns the debugger sessions of the client connected through ss,
+// creating them on first use. They are stopped once ss closes.
+func (m *sessionManager) client(ss *mcp.ServerSession) *clientSessions {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.shuttingDown {
+		// The debuggers of the client were stopped already, or never started.
+		return &clientSessions{closed: true}
+	}
+	c, ok := m.clients[ss]
+	if !ok {
+		c = &clientSessions{}
+		m.clients[ss] = c
+		if ss != nil {
+			go func() {
+				ss.Wait()
+				m.close(ss)
+			}()
+		}
+	}
+	return c
+}
+
+// close stops the debuggers of the client connected through ss and forgets them.
+func (m *sessionManager) close(ss *mcp.ServerSession) {
+	m.mu.Lock()
+	c, ok := m.clients[ss]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	c.mu.Lock()
+	closing := !c.closed
+	c.closed = true
+	sessions := c.sessions
+	c.sessions = nil
+	c.mu.Unlock()
+	if !closing {
+		m.mu.Unlock()
+		return
+	}
+	m.closing.Add(1)
+	m.mu.Unlock()
+	defer m.closing.Done()
+
+	for _, ds := range sessions {
+		ds.stop(ss)
+	}
+	m.mu.Lock()
+	delete(m.clients, ss)
+	m.mu.Unlock()
+}
+
+// errShuttingDown is returned by tools creating a session once the server shuts down.
+var errShuttingDown = errors.New("the server is shutting down")
+
+// create registers a tool call creating a session, which shutdown waits for.
+// The call must be followed by m.closing.Done.
+func (m *sessionManager) create() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.shuttingDown {
+		return errShuttingDown
+	}
+	m.closing.Add(1)
+	return nil
+}
+
+// shutdown stops the debuggers of every client, including those already
+// being stopped because their client went away or being started, and waits
+// until all of them, and the processes they started, are gone.
+func (m *sessionManager) shutdown() {
+	m.mu.Lock()
+	m.shuttingDown = true
+	clients := slices.Collect(maps.Keys(m.clients))
+	m.mu.Unlock()
+	for _, ss := range clients {
+		m.close(ss)
+	}
+	m.closing.Wait()
+}
+
+// lookup returns the session with the given ID and marks it as the most
+// recently used one. An empty ID selects the most recently used session;
+// if there is none, lookup returns a session that is not started.
+func (c *clientSessions) lookup(id string) (*debuggerSession, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if id == "" {
+		if len(c.sessions) == 0 {
+			return &debuggerSession{}, nil
+		}
+		return c.sessions[len(c.sessions)-1], nil
+	}
+	i := slices.IndexFunc(c.sessions, func(ds *debuggerSession) bool { return ds.id == id })
+	if i < 0 {
+		return nil, fmt.Errorf("%w: no session with ID %q, see list-sessions", errNotStarted, id)
+	}
+	ds := c.sessions[i]
+	c.sessions = append(slices.Delete(c.sessions, i, i+1), ds)
+	return ds, nil
+}
+
+// errClientGone is returned when a session is created for a client that is gone.
+var errClientGone = errors.New("the client session is closed")
+
+// add registers ds as the most recently used session.
+func (c *clientSessions) add(ds *debuggerSession) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errClientGone
+	}
+	c.sessions = append(c.sessions, ds)
+	return nil
+}
+
+// remove forgets ds.
+func (c *clientSessions) remove(ds *debuggerSession) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sessions = slices.DeleteFunc(c.sessions, func(s *debuggerSession) bool { return s == ds })
+}
+
+// list returns the sessions, from the least to the most recently used.
+func (c *clientSessions) list() []*debuggerSession {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.sessions)
+}
+
+// errSessionBusy is returned by tool calls made while another call holds the session.
+var errSessionBusy = errors.New("session busy")
+
+// callLock serializes the tool calls of a debugger session. Calls that change
+// the session hold it exclusively, while calls that only inspect it can share
+// it. A call that cannot get the session fails fast with errSessionBusy rather
+// than waiting behind a call that may block for a long time.
+type callLock struct {
+	mu sync.Mutex
+	// released is signalled whenever a call releases the session. It is
+	// bound to mu when first waited on, so that the zero callLock is ready to use.
+	released sync.Cond
+	// holder is the call holding the session exclusively, if any.
+	holder *toolCall
+	// shared counts the calls sharing the session.
+	shared int
+}
+
+// toolCall is a tool call holding a session.
+type toolCall struct {
+	tool      string
+	exclusive bool
+}
+
+// acquire lets a call of tool hold the session, exclusively or not,
+// or returns an error wrapping errSessionBusy.
+func (l *callLock) acquire(tool string, exclusive bool) (*toolCall, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.holder != nil {
+		return nil, fmt.Errorf("%w: %s is in progress, retry once it is done", errSessionBusy, l.holder.tool)
+	}
+	if exclusive && l.shared > 0 {
+		return nil, fmt.Errorf("%w: %d other tool calls are in progress, retry once they are done", errSessionBusy, l.shared)
+	}
+	call := &toolCall{tool: tool, exclusive: exclusive}
+	if exclusive {
+		l.holder = call
+	} else {
+		l.shared++
+	}
+	return call, nil
+}
+
+// lock holds the session exclusively for tool, waiting for other calls to
+// release it.
+func (l *callLock) lock(tool string) *toolCall {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.released.L = &l.mu
+	for l.holder != nil || l.shared > 0 {
+		l.released.Wait()
+	}
+	l.holder = &toolCall{tool: tool, exclusive: true}
+	return l.holder
+}
+
+// release ends the hold of call on the session, unless it yielded already.
+func (l *callLock) release(call *toolCall) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case !call.exclusive:
+		l.shared--
+	case l.holder == call:
+		l.holder = nil
+	default:
+		return
+	}
+	l.released.Broadcast()
+}
+
+// yield releases the session held exclusively by the running call for the
+// rest of the call, which must not touch the session fields from then on.
+// Execution control tools yield while they wait for the program to stop,
+// so that it can be paused and inspected meanwhile.
+func (l *callLock) yield() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.holder != nil {
+		l.holder = nil
+		l.released.Broadcast()
+	}
+}
+
+// sessionIDer is implemented by the parameters of tools that run on an existing
+// debugger session, which their sessionId parameter selects. Each of them
+// declares the field itself: the schemas of tool parameters do not flatten
+// embedded structs.
+type sessionIDer interface {
+	sessionID() string
+}
+
+func (p AttachParams) sessionID() string                  { return p.SessionID }
+func (p CapabilitiesParams) sessionID() string            { return p.SessionID }
+func (p ConfigurationDoneParams) sessionID() string       { return p.SessionID }
+func (p ContinueParams) sessionID() string                { return p.SessionID }
+func (p DebugCoreParams) sessionID() string               { return p.SessionID }
+func (p DebugProgramParams) sessionID() string            { return p.SessionID }
+func (p DebugTestParams) sessionID() string               { return p.SessionID }
+func (p DisassembleParams) sessionID() string             { return p.SessionID }
+func (p DisconnectParams) sessionID() string              { return p.SessionID }
+func (p EvaluateParams) sessionID() string                { return p.SessionID }
+func (p EventsParams) sessionID() string                  { return p.SessionID }
+func (p ExceptionInfoParams) sessionID() string           { return p.SessionID }
+func (p LoadedSourcesParams) sessionID() string           { return p.SessionID }
+func (p ModulesParams) sessionID() string                 { return p.SessionID }
+func (p NextParams) sessionID() string                    { return p.SessionID }
+func (p PauseParams) sessionID() string                   { return p.SessionID }
+func (p ProgramOutputParams) sessionID() string           { return p.SessionID }
+func (p RegistersParams) sessionID() string               { return p.SessionID }
+func (p RestartParams) sessionID() string                 { return p.SessionID }
+func (p ScopesParams) sessionID() string                  { return p.SessionID }
+func (p SessionStatusParams) sessionID() string           { return p.SessionID }
+func (p SetBreakpointsParams) sessionID() string          { return p.SessionID }
+func (p SetExceptionBreakpointsParams) sessionID() string { return p.SessionID }
+func (p SetFunctionBreakpointsParams) sessionID() string  { return p.SessionID }
+func (p SetVariableParams) sessionID() string             { return p.SessionID }
+func (p StackTraceParams) sessionID() string              { return p.SessionID }
+func (p StepInParams) sessionID() string                  { return p.SessionID }
+func (p StepOutParams) sessionID() string                 { return p.SessionID }
+func (p StopDebuggerParams) sessionID() string            { return p.SessionID }
+func (p TerminateParams) sessionID() string               { return p.SessionID }
+func (p ThreadsParams) sessionID() string                 { return p.SessionID }
+func (p VariablesParams) sessionID() string               { return p.SessionID }
+
+// sessionHandler is a debuggerSession method handling a tool call.
+type sessionHandler[In any] func(*debuggerSession, context.Context, *mcp.ServerSession, *mcp.CallToolParamsFor[In]) (*mcp.CallToolResultFor[any], error)
+
+// withSession adapts h to a tool handler that runs it on the debugger
+// session selected by the sessionId parameter, holding the session exclusively.
+func withSession[In sessionIDer](m *sessionManager, h sessionHandler[In]) mcp.ToolHandlerFor[In, any] {
+	return withLockedSession(m, h, true)
+}
+
+// withSharedSession is like withSession for handlers that only inspect the
+// session, which may run alongside each other.
+func withSharedSession[In sessionIDer](m *sessionManager, h sessionHandler[In]) mcp.ToolHandlerFor[In, any] {
+	return withLockedSession(m, h, false)
+}
+
+func withLockedSession[In sessionIDer](m *sessionManager, h sessionHandler[In], exclusive bool) mcp.ToolHandlerFor[In, any] {
+	return func(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[In]) (*mcp.CallToolResultFor[any], error) {
+		ds, err := m.client(ss).lookup(params.Arguments.sessionID())
+		if err != nil {
+			return nil, err
+		}
+		call, err := ds.calls.acquire(params.Name, exclusive)
+		if err != nil {
+			return nil, err
+		}
+		defer ds.calls.release(call)
+		return h(ds, ctx, ss, params)
+	}
+}
+
+// withNewSession is like withSession, but runs h on a new debugger session,
+// which becomes the most recently used one if h succeeds. A session created
+// while the server shuts down is stopped right away.
+func withNewSession[In any](m *sessionManager, h sessionHandler[In]) mcp.ToolHandlerFor[In, any] {
+	return func(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[In]) (*mcp.CallToolResultFor[any], error) {
+		if err := m.create(); err != nil {
+			return nil, err
+		}
+		defer m.closing.Done()
+		ds := &debuggerSession{}
+		res, err := h(ds, ctx, ss, params)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.client(ss).add(ds); err != nil {
+			ds.stop(ss)
+			return nil, err
+		}
+		return res, nil
+	}
+}
+
+// withEndSession is like withSession, but forgets the session once h succeeds.
+func withEndSession[In sessionIDer](m *sessionManager, h sessionHandler[In]) mcp.ToolHandlerFor[In, any] {
+	return func(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[In]) (*mcp.CallToolResultFor[any], error) {
+		c := m.client(ss)
+		ds, err := c.lookup(params.Arguments.sessionID())
+		if err != nil {
+			return nil, err
+		}
+		call, err := ds.calls.acquire(params.Name, true)
+		if err != nil {
+			return nil, err
+		}
+		defer ds.calls.release(call)
+		res, err := h(ds, ctx, ss, params)
+		if err != nil {
+			return nil, err
+		}
+		c.remove(ds)
+		return res, nil
+	}
+}
+
+// ListSessionsParams defines the parameters for listing debugger sessions.
+type ListSessionsParams struct {
+}
+
+// listSessions lists the debugger sessions of the calling client, starting
+// with the most recently used one, which tools default to. Sessions held by
+// a tool call that changes them are only reported as busy.
+func (m *sessionManager) listSessions(_ context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[ListSessionsParams]) (*mcp.CallToolResultFor[any], error) {
+	sessions := m.client(ss).list()
+	if len(sessions) == 0 {
+		return &mcp.CallToolResultFor[any]{
+			Content: []mcp.Content{&mcp.TextContent{Text: "No debugger sessions. Use start-debugger or connect-debugger to create one."}},
+		}, nil
+	}
+	var text strings.Builder
+	for i, ds := range slices.Backward(sessions) {
+		text.WriteString(ds.id)
+		if call, err := ds.calls.acquire(params.Name, false); err != nil {
+			text.WriteString(": busy")
+		} else {
+			if ds.label != "" {
+				fmt.Fprintf(&text, " %q", ds.label)
+			}
+			text.WriteString(": " + ds.adapter.name)
+			if program := ds.program(); program != "" {
+				text.WriteString(", " + program)
+			}
+			text.WriteString(", " + ds.status.current().String())
+			ds.calls.release(call)
+		}
+		if i == len(sessions)-1 {
+			text.WriteString(" (default)")
+		}
+		text.WriteString("\n")
+	}
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: text.String()}},
+	}, nil
+}
+
+// stop stops the debugger of a session whose client is gone, logging failures
+// since there is nobody left to report them to. It waits for the tool calls
+// in progress on the session to be done.
+func (ds *debuggerSession) stop(ss *mcp.ServerSession) {
+	defer ds.calls.release(ds.calls.lock("stop-debugger"))
+	if _, err := ds.stopDebugger(context.Background(), ss, &mcp.CallToolParamsFor[StopDebuggerParams]{}); err != nil {
+		log.Printf("Unable to stop debugger session %s: %v", ds.id, err)
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-dap"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// registerTestAdapter registers the helper stdio adapter as "test".
+func registerTestAdapter(t *testing.T) {
+	t.Setenv("MCP_DAP_HELPER_ADAPTER", "1")
+	adapters["test"] = &debugAdapter{
+		name: "test",
+		id:   "test",
+		command: func(string) []string {
+			return []string{os.Args[0], "-test.run=^TestHelperStdioAdapter$"}
+		},
+	}
+	t.Cleanup(func() { delete(adapters, "test") })
+}
+
+// connectClient connects a new MCP client to server through in-memory transports.
+func connectClient(t *testing.T, server *mcp.Server) *mcp.ClientSession {
+	t.Helper()
+	ctx := context.Background()
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	if _, err := server.Connect(ctx, serverTransport); err != nil {
+		t.Fatal(err)
+	}
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "v1.0.0"}, nil)
+	cs, err := client.Connect(ctx, clientTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cs
+}
+
+// callText calls a tool and returns the text of its result, failing the test on errors.
+func callText(t *testing.T, cs *mcp.ClientSession, name string, args map[string]any) string {
+	t.Helper()
+	res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: name, Arguments: args})
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	text := res.Content[0].(*mcp.TextContent).Text
+	if res.IsError {
+		t.Fatalf("%s failed: %s", name, text)
+	}
+	return text
+}
+
+func TestClientSessionIsolation(t *testing.T) {
+	registerTestAdapter(t)
+	server := mcp.NewServer(&mcp.Implementation{Name: "mcp-dap-server", Version: "v1.0.0"}, nil)
+	sessions := registerTools(server)
+	ctx := context.Background()
+	a, b := connectClient(t, server), connectClient(t, server)
+	defer b.Close()
+
+	res, err := a.CallTool(ctx, &mcp.CallToolParams{Name: "start-debugger", Arguments: map[string]any{"adapter": "test"}})
+	if err != nil || res.IsError {
+		t.Fatalf("start-debugger: %v %v", err, res)
+	}
+	res, err = b.CallTool(ctx, &mcp.CallToolParams{Name: "capabilities", Arguments: map[string]any{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsError {
+		t.Errorf("expected the second client to have no debugger, got %v", res.Content)
+	}
+
+	sessions.mu.Lock()
+	var started []*debuggerSession
+	for _, c := range sessions.clients {
+		started = append(started, c.list()...)
+	}
+	count := len(sessions.clients)
+	sessions.mu.Unlock()
+	if len(started) != 1 || count != 2 {
+		t.Fatalf("expected two clients, one with a debugger; got %d clients and %d debuggers", count, len(started))
+	}
+
+	a.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sessions.mu.Lock()
+		count = len(sessions.clients)
+		sessions.mu.Unlock()
+		if count == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the debugger session of the closed client was not cleaned up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if started[0].client != nil || started[0].cmd != nil {
+		t.Error("the debugger of the closed client was not stopped")
+	}
+}
+
+func TestNamedSessions(t *testing.T) {
+	registerTestAdapter(t)
+	server := mcp.NewServer(&mcp.Implementation{Name: "mcp-dap-server", Version: "v1.0.0"}, nil)
+	registerTools(server)
+	cs := connectClient(t, server)
+	defer cs.Close()
+
+	if text := callText(t, cs, "list-sessions", map[string]any{}); !strings.Contains(text, "No debugger sessions") {
+		t.Errorf("unexpected session list: %s", text)
+	}
+	sessionIDPattern := regexp.MustCompile(`Session ID: (\w+)`)
+	var ids []string
+	for _, label := range []string{"server", "client"} {
+		text := callText(t, cs, "start-debugger", map[string]any{"adapter": "test", "label": label})
+		m := sessionIDPattern.FindStringSubmatch(text)
+		if m == nil {
+			t.Fatalf("no session ID in %q", text)
+		}
+		ids = append(ids, m[1])
+	}
+
+	// The session started last is the default until another one is used.
+	text := callText(t, cs, "list-sessions", map[string]any{})
+	if !strings.Contains(text, ids[1]+` "client": test, adapter-started (default)`) || !strings.Contains(text, ids[0]+` "server": test, adapter-started`) {
+		t.Errorf("unexpected session list: %s", text)
+	}
+	callText(t, cs, "capabilities", map[string]any{"sessionId": ids[0]})
+	if text := callText(t, cs, "list-sessions", map[string]any{}); !strings.Contains(text, `"server": test, adapter-started (default)`) {
+		t.Errorf("expected the server session to be the default after using it: %s", text)
+	}
+
+	res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "capabilities", Arguments: map[string]any{"sessionId": "nope"}})
+	if err != nil || !res.IsError {
+		t.Errorf("expected an unknown session ID to be refused, got %v, %v", res, err)
+	}
+
+	callText(t, cs, "stop-debugger", map[string]any{})
+	text = callText(t, cs, "list-sessions", map[string]any{})
+	if strings.Contains(text, ids[0]) || !strings.Contains(text, `"client": test, adapter-started (default)`) {
+		t.Errorf("expected only the client session to remain: %s", text)
+	}
+	callText(t, cs, "stop-debugger", map[string]any{"sessionId": ids[1]})
+}
+
+func TestShutdown(t *testing.T) {
+	registerTestAdapter(t)
+	server := mcp.NewServer(&mcp.Implementation{Name: "mcp-dap-server", Version: "v1.0.0"}, nil)
+	sessions := registerTools(server)
+	cs := connectClient(t, server)
+	defer cs.Close()
+
+	callText(t, cs, "start-debugger", map[string]any{"adapter": "test"})
+	var started []*debuggerSession
+	for _, c := range sessions.clients {
+		started = append(started, c.list()...)
+	}
+	if len(started) != 1 {
+		t.Fatalf("expected one debugger session, got %d", len(started))
+	}
+
+	sessions.shutdown()
+	if started[0].cmd != nil || started[0].client != nil {
+		t.Error("shutdown did not stop the debugger")
+	}
+	if len(sessions.clients) != 0 {
+		t.Errorf("shutdown left %d clients", len(sessions.clients))
+	}
+}
+
+func TestShutdownWhileStarting(t *testing.T) {
+	m := newSessionManager()
+	starting := make(chan *debuggerSession)
+	started := make(chan struct{})
+	startTool := withNewSession(m, func(ds *debuggerSession, _ context.Context, _ *mcp.ServerSession, _ *mcp.CallToolParamsFor[StartDebuggerParams]) (*mcp.CallToolResultFor[any], error) {
+		starting <- ds
+		<-started
+		// The adapter is running once start-debugger succeeds.
+		ds.cmd = exec.Command("sleep", "300")
+		setProcessGroup(ds.cmd)
+		if err := ds.cmd.Start(); err != nil {
+			return nil, err
+		}
+		ds.ownsAdapter = true
+		return &mcp.CallToolResultFor[any]{}, nil
+	})
+	ctx := context.Background()
+	done := make(chan error)
+	go func() {
+		_, err := startTool(ctx, nil, &mcp.CallToolParamsFor[StartDebuggerParams]{Name: "start-debugger"})
+		done <- err
+	}()
+	ds := <-starting
+
+	stopped := make(chan struct{})
+	go func() {
+		m.shutdown()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		t.Fatal("shutdown did not wait for start-debugger")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(started)
+	<-stopped
+	if err := <-done; !errors.Is(err, errClientGone) {
+		t.Errorf("expected the session started during shutdown to be refused, got %v", err)
+	}
+	if ds.cmd != nil {
+		t.Error("the adapter started during shutdown was not stopped")
+	}
+	if _, err := startTool(ctx, nil, &mcp.CallToolParamsFor[StartDebuggerParams]{Name: "start-debugger"}); !errors.Is(err, errShuttingDown) {
+		t.Errorf("expected start-debugger to be refused after shutdown, got %v", err)
+	}
+}
+
+func TestConcurrentToolCalls(t *testing.T) {
+	client, adapter := newFakeAdapter(t)
+	ds := &debuggerSession{client: client, adapter: delveAdapter, status: sessionStatus{state: stateStopped}}
+	client.Subscribe(ds.status.recordEvent)
+	m := newSessionManager()
+	if err := m.client(nil).add(ds); err != nil {
+		t.Fatal(err)
+	}
+	continued := make(chan struct{})
+	answerContinue := make(chan struct{})
+	go func() {
+		for {
+			msg, err := dap.ReadProtocolMessage(adapter.reader)
+			if err != nil {
+				return
+			}
+			switch req := msg.(type) {
+			case *dap.ContinueRequest:
+				close(continued)
+				<-answerContinue
+				adapter.write(t, &dap.ContinueResponse{Response: newResponse(req)})
+			case *dap.ThreadsRequest:
+				adapter.write(t, &dap.ThreadsResponse{Response: newResponse(req), Body: dap.ThreadsResponseBody{Threads: []dap.Thread{{Id: 1, Name: "main"}}}})
+			case *dap.PauseRequest:
+				adapter.write(t, &dap.PauseResponse{Response: newResponse(req)})
+				adapter.write(t, &dap.StoppedEvent{Event: newEvent("stopped"), Body: dap.StoppedEventBody{Reason: "pause", ThreadId: 1}})
+			default:
+				t.Errorf("unexpected request %#v", req)
+				return
+			}
+		}
+	}()
+
+	ctx := context.Background()
+	continueTool := withSession(m, (*debuggerSession).continueExecution)
+	threadsTool := withSharedSession(m, (*debuggerSession).listThreads)
+	done := make(chan *mcp.CallToolResultFor[any])
+	go func() {
+		res, err := continueTool(ctx, nil, &mcp.CallToolParamsFor[ContinueParams]{Name: "continue"})
+		if err != nil {
+			t.Errorf("continue: %v", err)
+		}
+		done <- res
+	}()
+
+	// While continue waits for its response, the session is busy.
+	<-continued
+	_, err := threadsTool(ctx, nil, &mcp.CallToolParamsFor[ThreadsParams]{Name: "threads"})
+	if !errors.Is(err, errSessionBusy) || !strings.Contains(err.Error(), "continue is in progress") {
+		t.Errorf("expected threads to fail fast while continue is sent, got %v", err)
+	}
+	close(answerContinue)
+
+	// Once the program runs, continue only waits for it to stop: the
+	// session can be inspected and the program paused meanwhile.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err = threadsTool(ctx, nil, &mcp.CallToolParamsFor[ThreadsParams]{Name: "threads"})
+		if !errors.Is(err, errSessionBusy) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("threads while the program runs: %v", err)
+	}
+	pauseTool := withSharedSession(m, (*debuggerSession).pauseExecution)
+	if _, err := pauseTool(ctx, nil, &mcp.CallToolParamsFor[PauseParams]{Name: "pause", Arguments: PauseParams{ThreadID: 1}}); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+	if res := <-done; res == nil || !strings.Contains(res.Content[0].(*mcp.TextContent).Text, "Continued execution") {
+		t.Errorf("unexpected continue result %v", res)
+	}
+}
+
+func TestListBusySession(t *testing.T) {
+	client, adapter := newFakeAdapter(t)
+	ds := &debuggerSession{id: "s1", client: client, adapter: delveAdapter, status: sessionStatus{state: stateAdapterStarted}}
+	m := newSessionManager()
+	if err := m.client(nil).add(ds); err != nil {
+		t.Fatal(err)
+	}
+	launched := make(chan struct{})
+	answerLaunch := make(chan struct{})
+	go func() {
+		req := adapter.readRequest(t)
+		if req == nil {
+			return
+		}
+		close(launched)
+		<-answerLaunch
+		adapter.write(t, &dap.LaunchResponse{Response: newResponse(req)})
+	}()
+
+	ctx := context.Background()
+	debugTool := withSession(m, (*debuggerSession).debugProgram)
+	done := make(chan error)
+	go func() {
+		_, err := debugTool(ctx, nil, &mcp.CallToolParamsFor[DebugProgramParams]{Name: "debug-program", Arguments: DebugProgramParams{Path: "./app"}})
+		done <- err
+	}()
+	list := func() string {
+		t.Helper()
+		res, err := m.listSessions(ctx, nil, &mcp.CallToolParamsFor[ListSessionsParams]{Name: "list-sessions"})
+		if err != nil {
+			t.Fatalf("list-sessions: %v", err)
+		}
+		return res.Content[0].(*mcp.TextContent).Text
+	}
+
+	// The launch changes the session: it is not read meanwhile.
+	<-launched
+	if text := list(); text != "s1: busy (default)\n" {
+		t.Errorf("unexpected session list while launching: %q", text)
+	}
+	close(answerLaunch)
+	if err := <-done; err != nil {
+		t.Fatalf("debug-program: %v", err)
+	}
+	if text := list(); !strings.Contains(text, "s1: dlv, debug ./app, launched (default)") {
+		t.Errorf("unexpected session list after the launch: %q", text)
+	}
+}
+
+func TestCallLock(t *testing.T) {
+	var l callLock
+	a, err := l.acquire("threads", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := l.acquire("stack-trace", false)
+	if err != nil {
+		t.Fatalf("expected shared calls to run together, got %v", err)
+	}
+	if _, err := l.acquire("next", true); !errors.Is(err, errSessionBusy) {
+		t.Errorf("expected an exclusive call to fail while others share the session, got %v", err)
+	}
+	l.release(a)
+	l.release(b)
+
+	c, err := l.acquire("next", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.acquire("threads", false); !errors.Is(err, errSessionBusy) {
+		t.Errorf("expected a shared call to fail while the session is held, got %v", err)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		l.release(l.lock("stop-debugger"))
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		t.Fatal("lock did not wait for the call holding the session")
+	case <-time.After(50 * time.Millisecond):
+	}
+	l.release(c)
+	<-stopped
+}
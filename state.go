@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/google/go-dap"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// sessionState is a stage in the lifecycle of a debugger session.
+type sessionState int
+
+const (
+	// stateNotStarted means no debug adapter is connected.
+	stateNotStarted sessionState = iota
+	// stateAdapterStarted means the adapter is initialized but has no program yet.
+	stateAdapterStarted
+	// stateLaunched means a program was launched or attached to, and the
+	// adapter waits for breakpoints and configuration-done.
+	stateLaunched
+	// stateConfigured means configuration is done and the program is starting.
+	stateConfigured
+	// stateRunning means the program is running.
+	stateRunning
+	// stateStopped means the program is stopped and can be inspected.
+	stateStopped
+	// stateTerminated means the debug session of the program has ended.
+	stateTerminated
+	// stateExited means the program has exited.
+	stateExited
+)
+
+var stateNames = [...]string{
+	stateNotStarted:     "not-started",
+	stateAdapterStarted: "adapter-started",
+	stateLaunched:       "launched",
+	stateConfigured:     "configured",
+	stateRunning:        "running",
+	stateStopped:        "stopped",
+	stateTerminated:     "terminated",
+	stateExited:         "exited",
+}
+
+func (s sessionState) String() string {
+	return stateNames[s]
+}
+
+// errInvalidState is returned by tools used in a state of the session they
+// cannot work in, e.g. step-in while the program is running.
+var errInvalidState = errors.New("not available in this session state")
+
+// liveStates are the states of a session whose program was started and has
+// not ended yet.
+var liveStates = []sessionState{stateLaunched, stateConfigured, stateRunning, stateStopped}
+
+// resumeStates are the states of a session whose program can be resumed.
+// A launched program has not started yet: resuming it starts it, which
+// Delve allows without configuration-done. Adapters that only answer the
+// launch request once configured need configuration-done first.
+var resumeStates = []sessionState{stateLaunched, stateStopped}
+
+// restartStates are the states of a session whose program can be restarted,
+// including once it ended.
+var restartStates = []sessionState{stateLaunched, stateConfigured, stateRunning, stateStopped, stateTerminated, stateExited}
+
+// sessionStatus tracks the state of a session from the tools it ran and the
+// events the adapter sent, along with what is known about its program.
+type sessionStatus struct {
+	mu    sync.Mutex
+	state sessionState
+	// stop is the body of the last stopped event.
+	stop dap.StoppedEventBody
+	// exitCode is the exit code of the program, once it exited.
+	exitCode int
+	// pid is the ID of the program's process, if the adapter reported it
+	// or the session attached to it.
+	pid int
+}
+
+// current returns the state of the session.
+func (s *sessionStatus) current() sessionState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// set moves the session to state.
+func (s *sessionStatus) set(state sessionState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = state
+}
+
+// reset moves the session to state and forgets everything known about its program.
+func (s *sessionStatus) reset(state sessionState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = state
+	s.stop = dap.StoppedEventBody{}
+	s.exitCode = 0
+	s.pid = 0
+}
+
+// begin moves the session to state before sending a request that leads to it,
+// so that events answering the request cannot be overwritten. The returned
+// function moves it back if the request fails and no event changed the state since.
+func (s *sessionStatus) begin(state sessionState) (undo func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := s.state
+	s.state = state
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.state == state {
+			s.state = previous
+		}
+	}
+}
+
+// stopped moves the session to stateStopped for the given reason, unless a
+// stopped event got it there already.
+func (s *sessionStatus) stopped(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state != stateStopped {
+		s.state = stateStopped
+		s.stop = dap.StoppedEventBody{Reason: reason}
+	}
+}
+
+// setPID records the ID of the program's process.
+func (s *sessionStatus) setPID(pid int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pid = pid
+}
+
+// recordEvent updates the status from an event. It has the signature
+// expected by DAPClient.Subscribe.
+func (s *sessionStatus) recordEvent(event dap.EventMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch e := event.(type) {
+	case *dap.StoppedEvent:
+		s.state = stateStopped
+		s.stop = e.Body
+	case *dap.ContinuedEvent:
+		if s.state == stateStopped {
+			s.state = stateRunning
+		}
+	case *dap.ExitedEvent:
+		s.state = stateExited
+		s.exitCode = e.Body.ExitCode
+	case *dap.TerminatedEvent:
+		// The exit code is the more useful thing to report.
+		if s.state != stateExited {
+			s.state = stateTerminated
+		}
+	case *dap.ProcessEvent:
+		if e.Body.SystemProcessId != 0 {
+			s.pid = e.Body.SystemProcessId
+		}
+	}
+}
+
+// require returns an error wrapping errInvalidState, with a hint on what to
+// do instead, if tool cannot be used in the current state of the session.
+func (ds *debuggerSession) require(tool string, states ...sessionState) error {
+	ds.status.mu.Lock()
+	state, exitCode := ds.status.state, ds.status.exitCode
+	ds.status.mu.Unlock()
+	if slices.Contains(states, state) {
+		return nil
+	}
+	var hint string
+	switch state {
+	case stateNotStarted:
+		hint = "no debugger is running"
+	case stateAdapterStarted:
+		hint = "no program was started: use debug-program, exec-program, debug-test, debug-core or attach first"
+	case stateLaunched:
+		hint = "the program has not started yet: set breakpoints, then use configuration-done or continue to start it"
+	case stateConfigured, stateRunning:
+		hint = "the program is running: use pause to stop it"
+	case stateStopped:
+		hint = "the program is stopped: use continue, next, step-in or step-out to resume it"
+	case stateTerminated:
+		hint = "the debug session has ended: use restart to run the program again"
+	case stateExited:
+		hint = fmt.Sprintf("the program exited with code %d: use restart to run it again", exitCode)
+	}
+	return fmt.Errorf("%s is %w (%s): %s", tool, errInvalidState, state, hint)
+}
+
+// stopsOnEntry reports whether the program was launched with a request that
+// makes it stop as soon as it is started.
+func (c *sessionConfig) stopsOnEntry() bool {
+	if c == nil {
+		return false
+	}
+	return c.arguments["stopOnEntry"] == true || c.arguments["stopAtBeginningOfMainSubprogram"] == true
+}
+
+// program describes the program of the session, or returns "" if it has none.
+func (ds *debuggerSession) program() string {
+	switch {
+	case ds.coreFile != "":
+		return "core file " + ds.coreFile
+	case ds.config == nil:
+		return ""
+	case ds.config.request == "attach":
+		return "attached to a process"
+	case ds.config.program.Module != "":
+		return fmt.Sprintf("%s module %s", ds.config.mode, ds.config.program.Module)
+	}
+	return fmt.Sprintf("%s %s", ds.config.mode, ds.config.program.Path)
+}
+
+// SessionStatusParams defines the parameters for reporting the status of a session.
+type SessionStatusParams struct {
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
+}
+
+// getStatus reports the state of the session, its program and where the
+// program last stopped.
+func (ds *debuggerSession) getStatus(ctx context.Context, _ *mcp.ServerSession, _ *mcp.CallToolParamsFor[SessionStatusParams]) (*mcp.CallToolResultFor[any], error) {
+	ds.status.mu.Lock()
+	state, stop, exitCode, pid := ds.status.state, ds.status.stop, ds.status.exitCode, ds.status.pid
+	ds.status.mu.Unlock()
+
+	var text strings.Builder
+	if ds.id != "" {
+		text.WriteString("Session: " + ds.id)
+		if ds.label != "" {
+			fmt.Fprintf(&text, " %q", ds.label)
+		}
+		text.WriteString("\n")
+	}
+	if ds.adapter != nil {
+		text.WriteString("Adapter: " + ds.adapter.name + "\n")
+	}
+	text.WriteString("State: " + state.String())
+	switch state {
+	case stateStopped:
+		fmt.Fprintf(&text, " (%s", stop.Reason)
+		if stop.ThreadId != 0 {
+			fmt.Fprintf(&text, ", thread %d", stop.ThreadId)
+		}
+		text.WriteString(")")
+	case stateExited:
+		fmt.Fprintf(&text, " (code %d)", exitCode)
+	}
+	text.WriteString("\n")
+	if program := ds.program(); program != "" {
+		text.WriteString("Program: " + program + "\n")
+	}
+	if pid != 0 {
+		fmt.Fprintf(&text, "PID: %d\n", pid)
+	}
+	if state == stateStopped && stop.ThreadId != 0 {
+		text.WriteString("Stopped at: " + ds.location(ctx, stop.ThreadId) + "\n")
+	}
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: text.String()}},
+	}, nil
+}
+
+// location describes the top stack frame of a stopped thread.
+func (ds *debuggerSession) location(ctx context.Context, threadID int) string {
+	msg, err := ds.client.StackTraceRequest(ctx, threadID, 0, 1)
+	if err != nil {
+		return "unknown (" + err.Error() + ")"
+	}
+	resp, ok := msg.(*dap.StackTraceResponse)
+	if !ok || !resp.Success || len(resp.Body.StackFrames) == 0 {
+		return "unknown"
+	}
+	frame := resp.Body.StackFrames[0]
+	if frame.Source == nil {
+		return frame.Name
+	}
+	return fmt.Sprintf("%s at %s:%d", frame.Name, frame.Source.Path, frame.Line)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-dap"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestSessionState(t *testing.T) {
+	client, adapter := newFakeAdapter(t)
+	ds := &debuggerSession{client: client, adapter: delveAdapter}
+	ds.status.reset(stateAdapterStarted)
+	client.Subscribe(ds.status.recordEvent)
+	ctx := context.Background()
+
+	status := func() string {
+		t.Helper()
+		res, err := ds.getStatus(ctx, nil, &mcp.CallToolParamsFor[SessionStatusParams]{})
+		if err != nil {
+			t.Fatalf("session-status: %v", err)
+		}
+		return res.Content[0].(*mcp.TextContent).Text
+	}
+
+	_, err := ds.stepIn(ctx, nil, &mcp.CallToolParamsFor[StepInParams]{})
+	if !errors.Is(err, errInvalidState) || !strings.Contains(err.Error(), "debug-program") {
+		t.Errorf("expected step-in to be refused before a program is started, got %v", err)
+	}
+
+	go func() {
+		req := adapter.readRequest(t)
+		if req == nil {
+			return
+		}
+		adapter.write(t, &dap.LaunchResponse{Response: newResponse(req)})
+		adapter.write(t, &dap.ProcessEvent{Event: newEvent("process"), Body: dap.ProcessEventBody{Name: "./app", SystemProcessId: 4242}})
+	}()
+	if _, err := ds.debugProgram(ctx, nil, &mcp.CallToolParamsFor[DebugProgramParams]{Arguments: DebugProgramParams{Path: "./app"}}); err != nil {
+		t.Fatalf("debugProgram: %v", err)
+	}
+	if got := ds.status.current(); got != stateLaunched {
+		t.Errorf("got state %s after launch, want launched", got)
+	}
+	if _, err := ds.getStackTrace(ctx, nil, &mcp.CallToolParamsFor[StackTraceParams]{}); !errors.Is(err, errInvalidState) {
+		t.Errorf("expected stack-trace to be refused before the program stopped, got %v", err)
+	}
+
+	// The program stops on entry after configuration-done was answered,
+	// and configuration-done waits for it.
+	go func() {
+		req := adapter.readRequest(t)
+		if req == nil {
+			return
+		}
+		adapter.write(t, &dap.ConfigurationDoneResponse{Response: newResponse(req)})
+		adapter.write(t, &dap.StoppedEvent{Event: newEvent("stopped"), Body: dap.StoppedEventBody{Reason: "entry", ThreadId: 1}})
+		req = adapter.readRequest(t)
+		if req == nil {
+			return
+		}
+		adapter.write(t, &dap.StackTraceResponse{Response: newResponse(req), Body: dap.StackTraceResponseBody{
+			StackFrames: []dap.StackFrame{{Id: 1, Name: "main.main", Source: &dap.Source{Path: "/src/main.go"}, Line: 3}},
+		}})
+	}()
+	if _, err := ds.configurationDone(ctx, nil, &mcp.CallToolParamsFor[ConfigurationDoneParams]{}); err != nil {
+		t.Fatalf("configurationDone: %v", err)
+	}
+	text := status()
+	for _, want := range []string{"State: stopped (entry, thread 1)", "Program: debug ./app", "PID: 4242", "Stopped at: main.main at /src/main.go:3"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("session-status does not report %q:\n%s", want, text)
+		}
+	}
+	if _, err := ds.pauseExecution(ctx, nil, &mcp.CallToolParamsFor[PauseParams]{}); !errors.Is(err, errInvalidState) {
+		t.Errorf("expected pause to be refused while stopped, got %v", err)
+	}
+
+	go func() {
+		req := adapter.readRequest(t)
+		if req == nil {
+			return
+		}
+		adapter.write(t, &dap.ContinueResponse{Response: newResponse(req)})
+		adapter.write(t, &dap.ExitedEvent{Event: newEvent("exited"), Body: dap.ExitedEventBody{ExitCode: 3}})
+		adapter.write(t, &dap.TerminatedEvent{Event: newEvent("terminated")})
+	}()
+	if _, err := ds.continueExecution(ctx, nil, &mcp.CallToolParamsFor[ContinueParams]{}); err != nil {
+		t.Fatalf("continueExecution: %v", err)
+	}
+	if text := status(); !strings.Contains(text, "State: exited (code 3)") {
+		t.Errorf("session-status does not report the exit:\n%s", text)
+	}
+	_, err = ds.evaluateExpression(ctx, nil, &mcp.CallToolParamsFor[EvaluateParams]{Arguments: EvaluateParams{Expression: "x"}})
+	if !errors.Is(err, errInvalidState) || !strings.Contains(err.Error(), "exited with code 3") {
+		t.Errorf("expected evaluate to be refused once the program exited, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/google/go-dap"
+)
+
+// terminalProcesses tracks the processes started for runInTerminal requests.
+type terminalProcesses struct {
+	mu    sync.Mutex
+	procs map[int]*exec.Cmd
+}
+
+// run starts the command described by args on a pseudo-terminal, copying
+// everything it writes to the terminal into output, and returns its process ID.
+// The process is reaped in the background once it exits.
+func (t *terminalProcesses) run(args dap.RunInTerminalRequestArguments, output io.Writer) (int, error) {
+	if len(args.Args) == 0 {
+		return 0, errors.New("no command to run")
+	}
+	cmd := exec.Command(args.Args[0], args.Args[1:]...)
+	cmd.Dir = args.Cwd
+	cmd.Env = terminalEnv(args.Env)
+
+	terminal, err := startInTerminal(cmd)
+	if err != nil {
+		return 0, err
+	}
+	pid := cmd.Process.Pid
+
+	t.mu.Lock()
+	if t.procs == nil {
+		t.procs = make(map[int]*exec.Cmd)
+	}
+	t.procs[pid] = cmd
+	t.mu.Unlock()
+
+	go func() {
+		// Reading the terminal fails once the process and all its
+		// children have closed it, which is how we learn it is done.
+		io.Copy(output, terminal)
+		terminal.Close()
+		cmd.Wait()
+		t.mu.Lock()
+		delete(t.procs, pid)
+		t.mu.Unlock()
+	}()
+	return pid, nil
+}
+
+// killAll kills every process still running in a terminal, along with
+// the processes they started.
+func (t *terminalProcesses) killAll() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, cmd := range t.procs {
+		killProcessGroup(cmd)
+	}
+}
+
+// terminalEnv returns the environment for a runInTerminal command: the
+// server's own environment with the requested changes applied.
+// Per the DAP specification a null value removes the variable.
+func terminalEnv(changes map[string]any) []string {
+	env := os.Environ()
+	if len(changes) == 0 {
+		return env
+	}
+	vars := make(map[string]string, len(env))
+	var order []string
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		if _, ok := vars[k]; !ok {
+			order = append(order, k)
+		}
+		vars[k] = v
+	}
+	for k, v := range changes {
+		if v == nil {
+			delete(vars, k)
+			continue
+		}
+		if _, ok := vars[k]; !ok {
+			order = append(order, k)
+		}
+		vars[k] = fmt.Sprint(v)
+	}
+	env = env[:0]
+	for _, k := range order {
+		if v, ok := vars[k]; ok {
+			env = append(env, k+"="+v)
+		}
+	}
+	return env
+}
@@ -0,0 +1,29 @@
+//go:build !linux
+
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+)
+
+// startInTerminal starts cmd with its output connected to a pipe.
+// Pseudo-terminals are only supported on Linux; elsewhere the program
+// runs without a controlling terminal but its output is still captured.
+func startInTerminal(cmd *exec.Cmd) (io.ReadCloser, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer w.Close()
+
+	cmd.Stdout = w
+	cmd.Stderr = w
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
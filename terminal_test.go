@@ -0,0 +1,74 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-dap"
+)
+
+func TestRunInTerminal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a POSIX shell")
+	}
+	client, adapter := newFakeAdapter(t)
+	ds := &debuggerSession{client: client, output: newOutputBuffer(defaultOutputSize)}
+	client.HandleReverseRequests(ds.handleReverseRequest)
+	defer ds.terminal.killAll()
+
+	adapter.write(t, &dap.RunInTerminalRequest{
+		Request: dap.Request{ProtocolMessage: dap.ProtocolMessage{Type: "request"}, Command: "runInTerminal"},
+		Arguments: dap.RunInTerminalRequestArguments{
+			Kind: "integrated",
+			Cwd:  t.TempDir(),
+			Args: []string{"sh", "-c", `echo "$GREETING from $(pwd)"`},
+			Env:  map[string]any{"GREETING": "hello"},
+		},
+	})
+
+	msg, err := dap.ReadProtocolMessage(adapter.reader)
+	if err != nil {
+		t.Fatalf("reading runInTerminal response: %v", err)
+	}
+	resp, ok := msg.(*dap.RunInTerminalResponse)
+	if !ok {
+		t.Fatalf("expected *dap.RunInTerminalResponse, got %#v", msg)
+	}
+	if !resp.Success || resp.Body.ProcessId == 0 {
+		t.Fatalf("unexpected runInTerminal response: %+v", resp)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		entries, _ := ds.output.since(0, func(e outputEntry) bool { return e.Category == "terminal" })
+		var text strings.Builder
+		for _, e := range entries {
+			text.WriteString(e.Output)
+		}
+		if strings.Contains(text.String(), "hello from") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("terminal output was not captured, got %q", text.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUnsupportedReverseRequest(t *testing.T) {
+	_, adapter := newFakeAdapter(t)
+
+	adapter.write(t, &dap.StartDebuggingRequest{
+		Request: dap.Request{ProtocolMessage: dap.ProtocolMessage{Type: "request"}, Command: "startDebugging"},
+	})
+	msg, err := dap.ReadProtocolMessage(adapter.reader)
+	if err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	resp, ok := msg.(*dap.ErrorResponse)
+	if !ok || resp.Success || resp.Command != "startDebugging" {
+		t.Fatalf("expected an error response to startDebugging, got %#v", msg)
+	}
+}
@@ -1,244 +1,693 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/go-dap"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
 type debuggerSession struct {
-	cmd    *exec.Cmd
-	client *DAPClient
+	// id identifies the session in tool parameters and DAP traces.
+	id string
+	// label is an optional name given to the session when it was created.
+	label string
+	// adapter is the kind of debug adapter the session runs.
+	adapter *debugAdapter
+	// cmd is the adapter process, if the session started one.
+	cmd *exec.Cmd
+	// ownsAdapter is false when the session connected to an adapter
+	// someone else started, which must then be left running.
+	ownsAdapter bool
+	// remote is set once the session attached to the process of a
+	// headless Delve server, which must be left running on disconnect.
+	remote bool
+	// coreFile is the core dump the session debugs, if any. Such a
+	// session is read-only: tools that run the program are refused.
+	coreFile string
+	// config is the launch or attach request of the session, replayed by restart.
+	config *sessionConfig
+	// pendingStart waits for the response to the launch or attach request,
+	// for adapters that only answer it after configurationDone.
+	pendingStart func(context.Context) error
+	// breakpoints, functionBreakpoints and exceptionFilters record the
+	// breakpoints set through the tools, re-applied after a restart.
+	// breakpoints holds the lines of each source file.
+	breakpoints         map[string][]int
+	functionBreakpoints []string
+	exceptionFilters    []string
+	client              *DAPClient
+	// terminal holds the processes started on behalf of the debug adapter
+	// through runInTerminal requests.
+	terminal terminalProcesses
+	// events records every event received from the DAP server
+	// since the debugger was started.
+	events *eventJournal
+	// output keeps what the debuggee and the debug adapter printed.
+	output *outputBuffer
+	// capabilities are the features the debug adapter advertised
+	// in its response to the initialize request.
+	capabilities *dap.Capabilities
+	// socketDir is the private directory holding the unix socket dlv
+	// listens on, if any.
+	socketDir string
+	// tracer records the DAP messages of the session, if tracing is on.
+	tracer *dapTracer
+	// status is the lifecycle state of the session, which decides the
+	// tools that can be used, and what is known about its program.
+	status sessionStatus
+	// calls serializes the tool calls made on the session.
+	calls callLock
 }
 
 // registerTools registers the debugger tools with the MCP server.
-// It adds two tools: start-debugger for starting a DAP server and stop-debugger for stopping it.
-func registerTools(server *mcp.Server) {
-	ds := &debuggerSession{}
-	mcp.AddTool(server, &mcp.Tool{
+// start-debugger and connect-debugger create a new debugger session, which
+// the other tools use unless they are given the ID of another one. Every
+// connected client has sessions of its own, held by the returned sessionManager.
+func registerTools(server *mcp.Server) *sessionManager {
+	sessions := newSessionManager()
+	addTool(server, &mcp.Tool{
 		Name:        "start-debugger",
-		Description: "Starts a debugger exposed via a DAP server. You can provide the port you would like the debugger DAP server to listen on.",
-	}, ds.startDebugger)
-	mcp.AddTool(server, &mcp.Tool{
+		Description: "Starts a debugger exposed via a DAP server in a new debugger session. You can provide the port you would like the debugger DAP server to listen on.",
+	}, withNewSession(sessions, (*debuggerSession).startDebugger))
+	addTool(server, &mcp.Tool{
+		Name:        "connect-debugger",
+		Description: "Connects to a DAP server that is already running, such as a dlv dap started elsewhere or an adapter in a container. Stopping the debugger later only disconnects from it.",
+	}, withNewSession(sessions, (*debuggerSession).connectDebugger))
+	addTool(server, &mcp.Tool{
+		Name:        "list-sessions",
+		Description: "Lists the debugger sessions with their IDs and labels. Tools use the most recently used session unless given a sessionId.",
+	}, sessions.listSessions)
+	addTool(server, &mcp.Tool{
 		Name:        "stop-debugger",
 		Description: "Stops an already running debugger.",
-	}, ds.stopDebugger)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withEndSession(sessions, (*debuggerSession).stopDebugger))
+	addTool(server, &mcp.Tool{
 		Name:        "debug-program",
 		Description: "Tells the debugger running via DAP to debug a local program.",
-	}, ds.debugProgram)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withSession(sessions, (*debuggerSession).debugProgram))
+	addTool(server, &mcp.Tool{
 		Name:        "exec-program",
 		Description: "Tells the debugger running via DAP to debug a local program that has already been compiled. The path to the program must be an absolute path, or the program must be in $PATH.",
-	}, ds.execProgram)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withSession(sessions, (*debuggerSession).execProgram))
+	addTool(server, &mcp.Tool{
+		Name:        "debug-test",
+		Description: "Tells the dlv debugger to build and debug the tests of a Go package. Set a function breakpoint on the test function (e.g. mypkg.TestFoo) before configuration-done to stop inside it.",
+	}, withSession(sessions, (*debuggerSession).debugTest))
+	addTool(server, &mcp.Tool{
+		Name:        "debug-core",
+		Description: "Tells the dlv debugger to open a core dump of a Go program. The session is read-only: threads, stacks and variables can be inspected, but the program cannot be run, stepped or modified.",
+	}, withSession(sessions, (*debuggerSession).debugCore))
+	addTool(server, &mcp.Tool{
 		Name:        "set-breakpoints",
 		Description: "Sets breakpoints in a source file at specified line numbers.",
-	}, ds.setBreakpoints)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withSession(sessions, (*debuggerSession).setBreakpoints))
+	addTool(server, &mcp.Tool{
 		Name:        "set-function-breakpoints",
 		Description: "Sets breakpoints on functions by name.",
-	}, ds.setFunctionBreakpoints)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withSession(sessions, (*debuggerSession).setFunctionBreakpoints))
+	addTool(server, &mcp.Tool{
+		Name:        "set-exception-breakpoints",
+		Description: "Sets the exceptions the program stops on, using the exception filters the debug adapter advertises (see the capabilities tool), e.g. raised or uncaught for Python.",
+	}, withSession(sessions, (*debuggerSession).setExceptionBreakpoints))
+	addTool(server, &mcp.Tool{
 		Name:        "configuration-done",
 		Description: "Indicates that the configuration phase is complete and debugging can begin.",
-	}, ds.configurationDone)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withSession(sessions, (*debuggerSession).configurationDone))
+	addTool(server, &mcp.Tool{
 		Name:        "continue",
 		Description: "Continues execution of the debugged program.",
-	}, ds.continueExecution)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withSession(sessions, (*debuggerSession).continueExecution))
+	addTool(server, &mcp.Tool{
 		Name:        "next",
 		Description: "Steps over the next line of code.",
-	}, ds.nextStep)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withSession(sessions, (*debuggerSession).nextStep))
+	addTool(server, &mcp.Tool{
 		Name:        "step-in",
 		Description: "Steps into a function call.",
-	}, ds.stepIn)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withSession(sessions, (*debuggerSession).stepIn))
+	addTool(server, &mcp.Tool{
 		Name:        "step-out",
 		Description: "Steps out of the current function.",
-	}, ds.stepOut)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withSession(sessions, (*debuggerSession).stepOut))
+	addTool(server, &mcp.Tool{
 		Name:        "pause",
 		Description: "Pauses execution of a thread.",
-	}, ds.pauseExecution)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withSharedSession(sessions, (*debuggerSession).pauseExecution))
+	addTool(server, &mcp.Tool{
 		Name:        "threads",
 		Description: "Lists all threads in the debugged program.",
-	}, ds.listThreads)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withSharedSession(sessions, (*debuggerSession).listThreads))
+	addTool(server, &mcp.Tool{
 		Name:        "stack-trace",
 		Description: "Gets the stack trace for a thread.",
-	}, ds.getStackTrace)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withSharedSession(sessions, (*debuggerSession).getStackTrace))
+	addTool(server, &mcp.Tool{
 		Name:        "scopes",
 		Description: "Gets the scopes for a stack frame.",
-	}, ds.getScopes)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withSharedSession(sessions, (*debuggerSession).getScopes))
+	addTool(server, &mcp.Tool{
 		Name:        "variables",
 		Description: "Gets variables in a scope.",
-	}, ds.getVariables)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withSharedSession(sessions, (*debuggerSession).getVariables))
+	addTool(server, &mcp.Tool{
 		Name:        "evaluate",
 		Description: "Evaluates an expression in the context of a stack frame.",
-	}, ds.evaluateExpression)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withSession(sessions, (*debuggerSession).evaluateExpression))
+	addTool(server, &mcp.Tool{
 		Name:        "disconnect",
 		Description: "Disconnects from the debugger.",
-	}, ds.disconnect)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withSession(sessions, (*debuggerSession).disconnect))
+	addTool(server, &mcp.Tool{
 		Name:        "exception-info",
 		Description: "Gets information about an exception in a thread.",
-	}, ds.getExceptionInfo)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withSharedSession(sessions, (*debuggerSession).getExceptionInfo))
+	addTool(server, &mcp.Tool{
 		Name:        "set-variable",
 		Description: "Sets the value of a variable in the debugged program.",
-	}, ds.setVariable)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withSession(sessions, (*debuggerSession).setVariable))
+	addTool(server, &mcp.Tool{
 		Name:        "restart",
 		Description: "Restarts the debugging session.",
-	}, ds.restartDebugger)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withSession(sessions, (*debuggerSession).restartDebugger))
+	addTool(server, &mcp.Tool{
 		Name:        "terminate",
 		Description: "Terminates the debuggee process.",
-	}, ds.terminateDebugger)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withSession(sessions, (*debuggerSession).terminateDebugger))
+	addTool(server, &mcp.Tool{
 		Name:        "loaded-sources",
 		Description: "Gets the list of all loaded source files.",
-	}, ds.getLoadedSources)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withSharedSession(sessions, (*debuggerSession).getLoadedSources))
+	addTool(server, &mcp.Tool{
 		Name:        "modules",
 		Description: "Gets the list of all loaded modules.",
-	}, ds.getModules)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withSharedSession(sessions, (*debuggerSession).getModules))
+	addTool(server, &mcp.Tool{
 		Name:        "disassemble",
 		Description: "Disassembles code at a memory reference.",
-	}, ds.disassembleCode)
-	mcp.AddTool(server, &mcp.Tool{
+	}, withSharedSession(sessions, (*debuggerSession).disassembleCode))
+	addTool(server, &mcp.Tool{
+		Name:        "registers",
+		Description: "Lists the CPU registers of a stack frame, for debug adapters of native code such as lldb-dap and gdb.",
+	}, withSharedSession(sessions, (*debuggerSession).getRegisters))
+	addTool(server, &mcp.Tool{
 		Name:        "attach",
 		Description: "Attaches the debugger to a running process.",
-	}, ds.attachDebugger)
+	}, withSession(sessions, (*debuggerSession).attachDebugger))
+	addTool(server, &mcp.Tool{
+		Name:        "events",
+		Description: "Lists the DAP events (stopped, output, thread, module, breakpoint, process, ...) received from the debugger. Pass the returned cursor as 'since' to poll for new events.",
+	}, withSharedSession(sessions, (*debuggerSession).listEvents))
+	addTool(server, &mcp.Tool{
+		Name:        "program-output",
+		Description: "Shows what the debugged program printed to stdout and stderr, plus debugger console messages. Supports tailing, polling with a cursor and filtering lines with a regular expression.",
+	}, withSharedSession(sessions, (*debuggerSession).programOutput))
+	addTool(server, &mcp.Tool{
+		Name:        "capabilities",
+		Description: "Shows the capabilities the debug adapter advertised when the debugger was started. Tools that rely on an unsupported capability are refused.",
+	}, withSharedSession(sessions, (*debuggerSession).getCapabilities))
+	addTool(server, &mcp.Tool{
+		Name:        "session-status",
+		Description: "Shows the state of a debugger session (adapter-started, launched, configured, running, stopped, terminated or exited), its program, the program's process ID and where it last stopped. Tools are refused in states they cannot work in.",
+	}, withSharedSession(sessions, (*debuggerSession).getStatus))
+	return sessions
 }
 
 // StartDebuggerParams defines the parameters for starting a debugger.
 type StartDebuggerParams struct {
-	Port string `json:"port" mcp:"the port for the DAP server to listen on"`
+	Adapter string   `json:"adapter,omitempty" mcp:"debug adapter to start: dlv (default), debugpy, lldb-dap or gdb"`
+	Port    string   `json:"port,omitempty" mcp:"the port for the DAP server to listen on (default: a free port)"`
+	Listen  string   `json:"listen,omitempty" mcp:"tcp (default) to listen on host:port, or unix to listen on a unix domain socket in a private temporary directory"`
+	Host    string   `json:"host,omitempty" mcp:"interface the DAP server listens on (default: 127.0.0.1); non-loopback addresses require MCP_DAP_ALLOW_REMOTE_LISTEN=1"`
+	Command []string `json:"command,omitempty" mcp:"command line of a debug adapter that speaks DAP over stdin/stdout; when set it is started instead of the adapter's own command and port is ignored"`
+	Label   string   `json:"label,omitempty" mcp:"name of the new debugger session, shown by list-sessions"`
+	// Trace is the path of a file every DAP message is appended to as a JSON line.
+	// It defaults to the MCP_DAP_TRACE environment variable.
+	Trace       string `json:"trace,omitempty" mcp:"path of a JSONL file to record every DAP message sent or received to (default: $MCP_DAP_TRACE)"`
+	TraceRedact bool   `json:"traceRedact,omitempty" mcp:"replace variable values and evaluation results in the trace with <redacted> (also enabled by MCP_DAP_TRACE_REDACT=1)"`
 }
 
-// startDebugger starts a debugger DAP server on the specified port.
-// It launches the delve debugger in DAP mode and configures it to listen on the given port.
-// If the port doesn't start with ":", it will be prefixed automatically.
+// startDebugger starts a debug adapter and performs the initialize handshake with it.
+// The adapter parameter selects the kind of adapter, Delve by default.
+// Adapters that listen on a socket, such as Delve, listen on the given port of the
+// loopback interface, or on a per-session unix domain socket. Listening on any other
+// interface must be allowed with MCP_DAP_ALLOW_REMOTE_LISTEN, since the DAP server
+// accepts connections without authentication.
+// Other adapters, or any adapter whose command line is given, are started as a child
+// process and DAP messages are exchanged over their standard input and output.
+// When tracing is requested, every DAP message is also recorded to a JSONL file.
 func (ds *debuggerSession) startDebugger(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[StartDebuggerParams]) (*mcp.CallToolResultFor[any], error) {
-	port := params.Arguments.Port
-	if !strings.HasPrefix(port, ":") {
-		port = ":" + port
-	}
-	ds.cmd = exec.Command("dlv", "dap", "--listen", port, "--log", "--log-output", "dap")
-	ds.cmd.Stderr = os.Stderr
-	stdout, err := ds.cmd.StdoutPipe()
+	adapter, err := lookupAdapter(params.Arguments.Adapter)
 	if err != nil {
 		return nil, err
 	}
-	if err := ds.cmd.Start(); err != nil {
+	if err := ds.beginSession(params.Arguments.Label, params.Arguments.Trace, params.Arguments.TraceRedact); err != nil {
 		return nil, err
 	}
-	r := bufio.NewReader(stdout)
-	for {
-		s, err := r.ReadString('\n')
-		if err != nil {
-			return nil, err
-		}
-		// Check if server has started
-		if strings.HasPrefix(s, "DAP server listening at") {
-			break
-		}
+	ds.ownsAdapter = true
+	address, err := ds.startAdapter(adapter, params.Arguments)
+	if err != nil {
+		ds.release()
+		return nil, err
 	}
 
-	ds.client = newDAPClient("localhost" + port)
-	if err := ds.client.InitializeRequest(); err != nil {
-		return nil, err
+	capabilities, err := ds.initialize(ctx, adapter)
+	if err != nil {
+		ds.release()
+		return nil, ds.adapterFailure(adapter, err)
 	}
-	// Read response to discover server capabilities
-	msg, err := ds.client.ReadMessage()
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: fmt.Sprintf("Started debugger at: %s\nSession ID: %s\n\nServer Capabilities:\n%s", address, ds.id, capabilities),
+			},
+		},
+	}, nil
+}
+
+// ConnectDebuggerParams defines the parameters for connecting to a running debug adapter.
+type ConnectDebuggerParams struct {
+	Address     string `json:"address" mcp:"host:port of the DAP server, or the path of its unix domain socket (optionally prefixed with unix:)"`
+	Adapter     string `json:"adapter,omitempty" mcp:"kind of debug adapter listening at address: dlv (default), debugpy, lldb-dap or gdb"`
+	Label       string `json:"label,omitempty" mcp:"name of the new debugger session, shown by list-sessions"`
+	Trace       string `json:"trace,omitempty" mcp:"path of a JSONL file to record every DAP message sent or received to (default: $MCP_DAP_TRACE)"`
+	TraceRedact bool   `json:"traceRedact,omitempty" mcp:"replace variable values and evaluation results in the trace with <redacted> (also enabled by MCP_DAP_TRACE_REDACT=1)"`
+}
+
+// connectTimeout bounds how long connect-debugger waits for the connection to be established.
+const connectTimeout = 10 * time.Second
+
+// connectDebugger connects to a DAP server that is already running, such as a
+// dlv dap started by someone else or an adapter in a container, and performs the
+// initialize handshake with it. The session does not own the adapter process:
+// stop-debugger disconnects from it but leaves it running.
+func (ds *debuggerSession) connectDebugger(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[ConnectDebuggerParams]) (*mcp.CallToolResultFor[any], error) {
+	adapter, err := lookupAdapter(params.Arguments.Adapter)
 	if err != nil {
 		return nil, err
 	}
-
-	// Extract capabilities from InitializeResponse
-	var capabilities dap.Capabilities
-	switch resp := msg.(type) {
-	case *dap.InitializeResponse:
-		capabilities = resp.Body
-	default:
-		return nil, fmt.Errorf("unexpected response type: %T", msg)
+	network, addr := dialAddress(params.Arguments.Address)
+	if addr == "" {
+		return nil, errors.New("address is required")
 	}
-
-	// Marshal capabilities to JSON for better readability
-	capabilitiesJSON, err := json.MarshalIndent(capabilities, "", "  ")
+	dialer := net.Dialer{Timeout: connectTimeout}
+	conn, err := dialer.DialContext(ctx, network, addr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal capabilities: %w", err)
+		return nil, fmt.Errorf("unable to connect to DAP server: %w", err)
+	}
+	if err := ds.beginSession(params.Arguments.Label, params.Arguments.Trace, params.Arguments.TraceRedact); err != nil {
+		conn.Close()
+		return nil, err
 	}
+	ds.client = newDAPClientFromConn(conn)
+	ds.ownsAdapter = false
 
+	capabilities, err := ds.initialize(ctx, adapter)
+	if err != nil {
+		ds.release()
+		return nil, err
+	}
 	return &mcp.CallToolResultFor[any]{
 		Content: []mcp.Content{
 			&mcp.TextContent{
-				Text: fmt.Sprintf("Started debugger at: %s\n\nServer Capabilities:\n%s", port, string(capabilitiesJSON)),
+				Text: fmt.Sprintf("Connected to debugger at: %s\nSession ID: %s\n\nServer Capabilities:\n%s", params.Arguments.Address, ds.id, capabilities),
 			},
 		},
 	}, nil
 }
 
+// dialAddress returns the network and address to dial for a DAP server address
+// given to connect-debugger: an address with a unix: prefix or a slash is a
+// unix domain socket, anything else is host:port.
+func dialAddress(address string) (network, addr string) {
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		return "unix", path
+	}
+	if strings.Contains(address, "/") {
+		return "unix", address
+	}
+	return "tcp", address
+}
+
+// beginSession assigns a new session ID and the label, resets the output buffer
+// and opens the DAP trace when tracing is requested by path or MCP_DAP_TRACE.
+func (ds *debuggerSession) beginSession(label, tracePath string, traceRedact bool) error {
+	ds.id = newSessionID()
+	ds.label = label
+	ds.remote = false
+	ds.coreFile = ""
+	ds.config = nil
+	ds.pendingStart = nil
+	ds.breakpoints = nil
+	ds.functionBreakpoints = nil
+	ds.exceptionFilters = nil
+	if tracePath == "" {
+		tracePath = os.Getenv("MCP_DAP_TRACE")
+	}
+	if tracePath != "" {
+		redact := traceRedact || os.Getenv("MCP_DAP_TRACE_REDACT") == "1"
+		tracer, err := newDAPTracer(tracePath, ds.id, redact)
+		if err != nil {
+			return fmt.Errorf("unable to open DAP trace: %w", err)
+		}
+		ds.tracer = tracer
+	}
+	ds.output = newOutputBuffer(defaultOutputSize)
+	return nil
+}
+
+// initialize hooks the session up to ds.client and performs the initialize handshake.
+// It returns the capabilities advertised by the adapter, as indented JSON.
+func (ds *debuggerSession) initialize(ctx context.Context, adapter *debugAdapter) (string, error) {
+	ds.adapter = adapter
+	if ds.tracer != nil {
+		ds.client.SetTrace(ds.tracer.trace)
+	}
+	ds.events = newEventJournal(defaultJournalSize)
+	ds.client.Subscribe(ds.events.record)
+	ds.client.Subscribe(ds.output.recordEvent)
+	ds.status.reset(stateAdapterStarted)
+	ds.client.Subscribe(ds.status.recordEvent)
+	ds.client.HandleReverseRequests(ds.handleReverseRequest)
+	// The response to initialize advertises the server capabilities
+	msg, err := ds.client.InitializeRequest(ctx, adapter.id)
+	if err != nil {
+		return "", err
+	}
+
+	if err := validateResponse(msg, "unable to initialize debug adapter"); err != nil {
+		return "", err
+	}
+
+	// Extract capabilities from InitializeResponse
+	resp, ok := msg.(*dap.InitializeResponse)
+	if !ok {
+		return "", unexpectedResponse(msg, "unable to initialize debug adapter")
+	}
+	ds.capabilities = &resp.Body
+
+	// Marshal capabilities to JSON for better readability
+	capabilitiesJSON, err := json.MarshalIndent(ds.capabilities, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal capabilities: %w", err)
+	}
+	return string(capabilitiesJSON), nil
+}
+
+// listenAddress returns the network ("tcp" or "unix") and address dlv should listen on.
+// For unix sockets it creates a private temporary directory that is removed when the debugger stops.
+func (ds *debuggerSession) listenAddress(params StartDebuggerParams) (network, addr string, err error) {
+	switch params.Listen {
+	case "", "tcp":
+		host := params.Host
+		if host == "" {
+			host = "127.0.0.1"
+		}
+		if !isLoopback(host) && os.Getenv("MCP_DAP_ALLOW_REMOTE_LISTEN") != "1" {
+			return "", "", fmt.Errorf("refusing to expose the DAP server on %s: anyone who can reach it can control the debuggee; set MCP_DAP_ALLOW_REMOTE_LISTEN=1 to allow it", host)
+		}
+		port := strings.TrimPrefix(params.Port, ":")
+		if port == "" || port == "0" {
+			var err error
+			if port, err = freePort(host); err != nil {
+				return "", "", fmt.Errorf("unable to find a free port on %s: %w", host, err)
+			}
+		}
+		return "tcp", net.JoinHostPort(host, port), nil
+	case "unix":
+		// os.MkdirTemp creates the directory with mode 0700, so only
+		// this user can connect to the socket inside it.
+		dir, err := os.MkdirTemp("", "mcp-dap-")
+		if err != nil {
+			return "", "", err
+		}
+		ds.socketDir = dir
+		return "unix", filepath.Join(dir, "dlv.sock"), nil
+	default:
+		return "", "", fmt.Errorf("unsupported listen mode %q: expected tcp or unix", params.Listen)
+	}
+}
+
+// freePort returns a TCP port on host that nothing listens on.
+// The port is only known to be free when freePort returns, so there is a
+// small window in which another process can take it; the adapter then fails
+// to start and the error says so.
+func freePort(host string) (string, error) {
+	l, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	return port, err
+}
+
+// isLoopback reports whether host names the loopback interface.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// handleReverseRequest answers the requests the debug adapter sends to the server.
+func (ds *debuggerSession) handleReverseRequest(request dap.RequestMessage) (dap.ResponseMessage, error) {
+	switch req := request.(type) {
+	case *dap.RunInTerminalRequest:
+		pid, err := ds.terminal.run(req.Arguments, ds.output.writer("terminal"))
+		if err != nil {
+			return nil, fmt.Errorf("unable to run in terminal: %w", err)
+		}
+		return &dap.RunInTerminalResponse{Body: dap.RunInTerminalResponseBody{ProcessId: pid}}, nil
+	}
+	return nil, fmt.Errorf("unsupported reverse request %q", request.GetRequest().Command)
+}
+
 // StopDebuggerParams defines the parameters for stopping a debugger.
-// Currently no parameters are needed to stop the debugger.
 type StopDebuggerParams struct {
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
 }
 
+// disconnectTimeout bounds how long stopDebugger waits for the adapter to
+// end or detach from the program before killing it.
+const disconnectTimeout = 5 * time.Second
+
 // stopDebugger stops the currently running debugger process.
 // It kills the debugger process and waits for it to exit.
+// A debugger the session connected to with connect-debugger is not killed:
+// the session disconnects from it and leaves it, and its debuggee, running.
 // If no debugger is running, it returns a message indicating this.
 func (ds *debuggerSession) stopDebugger(ctx context.Context, _ *mcp.ServerSession, _ *mcp.CallToolParamsFor[StopDebuggerParams]) (*mcp.CallToolResultFor[any], error) {
-	if ds.cmd == nil {
+	if ds.cmd == nil && ds.client == nil {
 		return &mcp.CallToolResultFor[any]{
 			Content: []mcp.Content{&mcp.TextContent{Text: "No debugger currently executing."}},
 		}, nil
 	}
 
+	text := "Debugger stopped."
+	switch {
+	case !ds.ownsAdapter && ds.client != nil:
+		// Someone else started the adapter; let it know we are leaving.
+		// Errors are ignored since the connection is closed right after.
+		ds.client.DisconnectRequest(ctx, false)
+		text = "Disconnected from debugger; it was not started by this server and keeps running."
+	case ds.client != nil && ds.config != nil:
+		// Ask the adapter to end a program it launched, or to detach from
+		// one it attached to, before it is killed: a program the adapter
+		// moved to a process group of its own would outlive it.
+		ctx, cancel := context.WithTimeout(ctx, disconnectTimeout)
+		ds.client.DisconnectRequest(ctx, ds.config.request == "launch")
+		cancel()
+	}
+
+	if err := ds.release(); err != nil {
+		return nil, err
+	}
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: text}},
+	}, nil
+}
+
+// release frees what the session holds: the connection to the adapter, the
+// processes it started, the directory of its unix socket and its DAP trace.
+// It is used when the debugger is stopped or disconnected and when starting
+// it failed.
+func (ds *debuggerSession) release() error {
 	// Close the DAP client connection if it exists
 	if ds.client != nil {
 		ds.client.Close()
 		ds.client = nil
 	}
+	ds.capabilities = nil
+	ds.status.reset(stateNotStarted)
 
-	// Kill the debugger process
-	if err := ds.cmd.Process.Kill(); err != nil {
-		// Ignore the error if the process has already exited
-		if !strings.Contains(err.Error(), "process already finished") {
-			return nil, err
-		}
+	// Kill anything started through runInTerminal, then the debugger process
+	if ds.ownsAdapter {
+		ds.terminal.killAll()
 	}
+	err := ds.killAdapter()
 
-	// Wait for the process to finish
-	ds.cmd.Wait() // Ignore error as process might have been killed
-	ds.cmd = nil
-
-	return &mcp.CallToolResultFor[any]{
-		Content: []mcp.Content{&mcp.TextContent{Text: "Debugger stopped."}},
-	}, nil
+	if ds.socketDir != "" {
+		os.RemoveAll(ds.socketDir)
+		ds.socketDir = ""
+	}
+	if ds.tracer != nil {
+		ds.tracer.Close()
+		ds.tracer = nil
+	}
+	return err
 }
 
 // DebugProgramParams defines the parameters for starting a debug session.
 // Path is the path to the program you would like to start debugging.
 type DebugProgramParams struct {
-	Path string `json:"path" mcp:"path to the program we want to start debugging."`
+	Path    string            `json:"path,omitempty" mcp:"path to the program we want to start debugging."`
+	Args    []string          `json:"args,omitempty" mcp:"command line arguments passed to the program"`
+	Cwd     string            `json:"cwd,omitempty" mcp:"working directory of the program"`
+	Env     map[string]string `json:"env,omitempty" mcp:"environment variables added to the environment of the program"`
+	Console string            `json:"console,omitempty" mcp:"where the program runs: internalConsole (default) or integratedTerminal to run it under a pseudo-terminal"`
+	// These parameters are only understood by the dlv adapter.
+	BuildFlags           string `json:"buildFlags,omitempty" mcp:"dlv only: flags passed to go build, e.g. -tags=integration"`
+	Output               string `json:"output,omitempty" mcp:"dlv only: path of the binary built in debug mode"`
+	HideSystemGoroutines bool   `json:"hideSystemGoroutines,omitempty" mcp:"dlv only: hide runtime goroutines from threads and stack traces"`
+	ShowGlobalVariables  bool   `json:"showGlobalVariables,omitempty" mcp:"dlv only: include the package variables of the current package in scopes"`
+	// These parameters are only understood by the debugpy adapter.
+	Module     string `json:"module,omitempty" mcp:"debugpy only: Python module to run (as with python -m) instead of path"`
+	JustMyCode *bool  `json:"justMyCode,omitempty" mcp:"debugpy only: only step through and break in user code (default: true)"`
+	Python     string `json:"python,omitempty" mcp:"debugpy only: path of the Python interpreter that runs the program"`
+	// LaunchArgs is an escape hatch for adapter options without a parameter of their own.
+	LaunchArgs map[string]any `json:"launchArgs,omitempty" mcp:"additional launch request arguments, merged over the ones built from the other parameters"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
+}
+
+// launchConfig returns the launch configuration described by p for the given mode.
+func (p DebugProgramParams) launchConfig(mode string) launchConfig {
+	return launchConfig{
+		Mode:    mode,
+		Program: p.Path,
+		Args:    p.Args,
+		Cwd:     p.Cwd,
+		Env:     p.Env,
+		Console: p.Console,
+
+		BuildFlags:           p.BuildFlags,
+		Output:               p.Output,
+		HideSystemGoroutines: p.HideSystemGoroutines,
+		ShowGlobalVariables:  p.ShowGlobalVariables,
+
+		Module:     p.Module,
+		JustMyCode: p.JustMyCode,
+		Python:     p.Python,
+	}
+}
+
+// launchArguments returns the arguments of the launch request described by p,
+// shaped for the session's adapter, with p.LaunchArgs merged over them.
+func (ds *debuggerSession) launchArguments(p DebugProgramParams, mode string) (map[string]any, error) {
+	args, err := ds.adapter.launchArguments(p.launchConfig(mode))
+	if err != nil {
+		return nil, err
+	}
+	maps.Copy(args, p.LaunchArgs)
+	return args, nil
+}
+
+// sessionConfig is the launch or attach request that started the program of a session.
+type sessionConfig struct {
+	// request is "launch" or "attach".
+	request string
+	// program and mode are the parameters the launch arguments were built from.
+	program DebugProgramParams
+	mode    string
+	// test holds the parameters of debug-test, which program was built from.
+	test *DebugTestParams
+	// arguments are the arguments of the request as sent to the adapter.
+	arguments map[string]any
+}
+
+// launch sends a launch request for the program described by p and
+// records it as the configuration of the session.
+func (ds *debuggerSession) launch(ctx context.Context, p DebugProgramParams, mode, errorPrefix string) error {
+	args, err := ds.launchArguments(p, mode)
+	if err != nil {
+		return err
+	}
+	if ds.adapter.answersAfterConfiguration {
+		wait, err := ds.client.StartLaunchRequest(args)
+		if err != nil {
+			return err
+		}
+		ds.deferStart(wait, errorPrefix)
+	} else {
+		msg, err := ds.client.LaunchRequest(ctx, args)
+		if err != nil {
+			return err
+		}
+		if err := validateResponse(msg, errorPrefix); err != nil {
+			return err
+		}
+	}
+	ds.config = &sessionConfig{request: "launch", program: p, mode: mode, arguments: args}
+	ds.status.set(stateLaunched)
+	return nil
+}
+
+// deferStart makes configuration-done check the response to a launch or
+// attach request, which wait waits for, since the adapter only answers it then.
+func (ds *debuggerSession) deferStart(wait func(context.Context) (dap.Message, error), errorPrefix string) {
+	ds.pendingStart = func(ctx context.Context) error {
+		msg, err := wait(ctx)
+		if err != nil {
+			return err
+		}
+		return validateResponse(msg, errorPrefix)
+	}
+}
+
+// requireConfigurationDone returns an error wrapping errInvalidState if the
+// response to the launch or attach request is still pending, since only
+// configuration-done waits for it and reports whether the program started.
+func (ds *debuggerSession) requireConfigurationDone(tool string) error {
+	if ds.pendingStart == nil {
+		return nil
+	}
+	return fmt.Errorf("%s is %w (%s): the %s adapter only starts the program once configured: call configuration-done first", tool, errInvalidState, stateLaunched, ds.adapter.name)
+}
+
+// configure sends a configurationDone request. If the launch or attach
+// request of the session is still unanswered, it then waits for that answer,
+// and forgets the program if it could not be started.
+func (ds *debuggerSession) configure(ctx context.Context) (dap.Message, error) {
+	msg, err := ds.client.ConfigurationDoneRequest(ctx)
+	if err != nil || ds.pendingStart == nil {
+		return msg, err
+	}
+	if err := validateResponse(msg, "unable to complete configuration"); err != nil {
+		return nil, err
+	}
+	wait := ds.pendingStart
+	ds.pendingStart = nil
+	if err := wait(ctx); err != nil {
+		ds.config = nil
+		ds.status.set(stateAdapterStarted)
+		return nil, err
+	}
+	return msg, nil
 }
 
 // debugProgram starts a debug session for the specified program.
@@ -246,25 +695,35 @@ type DebugProgramParams struct {
 // then reads the response to verify the launch was successful.
 // Returns an error if the launch fails or if the DAP server reports failure.
 func (ds *debuggerSession) debugProgram(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[DebugProgramParams]) (*mcp.CallToolResultFor[any], error) {
-	path := params.Arguments.Path
-	if err := ds.client.LaunchRequest("debug", path, true); err != nil {
+	if ds.client == nil {
+		return nil, errNotStarted
+	}
+	if err := ds.require("debug-program", stateAdapterStarted); err != nil {
 		return nil, err
 	}
-	if err := readAndValidateResponse(ds.client, "unable to launch program to debug via DAP server"); err != nil {
+	path := params.Arguments.Path
+	if err := ds.launch(ctx, params.Arguments, "debug", "unable to launch program to debug via DAP server"); err != nil {
 		return nil, err
 	}
 
+	if params.Arguments.Module != "" {
+		path = "module " + params.Arguments.Module
+	}
+
 	return &mcp.CallToolResultFor[any]{
 		Content: []mcp.Content{&mcp.TextContent{Text: "Started debugging: " + path}},
 	}, nil
 }
 
 func (ds *debuggerSession) execProgram(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[DebugProgramParams]) (*mcp.CallToolResultFor[any], error) {
-	path := params.Arguments.Path
-	if err := ds.client.LaunchRequest("exec", path, true); err != nil {
+	if ds.client == nil {
+		return nil, errNotStarted
+	}
+	if err := ds.require("exec-program", stateAdapterStarted); err != nil {
 		return nil, err
 	}
-	if err := readAndValidateResponse(ds.client, "unable to exec program to debug via DAP server"); err != nil {
+	path := params.Arguments.Path
+	if err := ds.launch(ctx, params.Arguments, "exec", "unable to exec program to debug via DAP server"); err != nil {
 		return nil, err
 	}
 
@@ -273,24 +732,201 @@ func (ds *debuggerSession) execProgram(ctx context.Context, _ *mcp.ServerSession
 	}, nil
 }
 
-// readAndValidateResponse reads a DAP message and validates the response.
-// It returns an error if the read fails or if the response indicates failure.
-// The generic type T allows this function to be used with different response types.
-func readAndValidateResponse(client *DAPClient, errorPrefix string) error {
-	for {
-		msg, err := client.ReadMessage()
-		if err != nil {
-			return err
-		}
-		switch resp := msg.(type) {
-		case dap.ResponseMessage:
-			if !resp.GetResponse().Success {
-				return fmt.Errorf("%s: %s", errorPrefix, resp.GetResponse().Message)
+// DebugTestParams defines the parameters for debugging the tests of a Go package.
+type DebugTestParams struct {
+	Package    string            `json:"package" mcp:"directory of the Go package whose tests are debugged"`
+	Run        string            `json:"run,omitempty" mcp:"only run the tests matching this regular expression, as with go test -run"`
+	Count      int               `json:"count,omitempty" mcp:"run each test this many times, as with go test -count"`
+	Tags       []string          `json:"tags,omitempty" mcp:"build tags, as with go test -tags"`
+	Args       []string          `json:"args,omitempty" mcp:"additional arguments passed to the test binary, e.g. -test.v"`
+	Cwd        string            `json:"cwd,omitempty" mcp:"working directory of the test binary (default: the package directory)"`
+	Env        map[string]string `json:"env,omitempty" mcp:"environment variables added to the environment of the tests"`
+	BuildFlags string            `json:"buildFlags,omitempty" mcp:"additional flags passed to go test when building the test binary"`
+	LaunchArgs map[string]any    `json:"launchArgs,omitempty" mcp:"additional launch request arguments, merged over the ones built from the other parameters"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
+}
+
+// programParams returns the launch parameters of the test binary described by p.
+func (p DebugTestParams) programParams() DebugProgramParams {
+	var args []string
+	if p.Run != "" {
+		args = append(args, "-test.run", p.Run)
+	}
+	if p.Count > 0 {
+		args = append(args, "-test.count", strconv.Itoa(p.Count))
+	}
+	args = append(args, p.Args...)
+
+	buildFlags := p.BuildFlags
+	if len(p.Tags) > 0 {
+		buildFlags = strings.TrimSpace("-tags=" + strings.Join(p.Tags, ",") + " " + buildFlags)
+	}
+	return DebugProgramParams{
+		Path:       p.Package,
+		Args:       args,
+		Cwd:        p.Cwd,
+		Env:        p.Env,
+		BuildFlags: buildFlags,
+		LaunchArgs: p.LaunchArgs,
+	}
+}
+
+// debugTest starts a debug session for the tests of a Go package,
+// using the test launch mode of Delve.
+func (ds *debuggerSession) debugTest(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[DebugTestParams]) (*mcp.CallToolResultFor[any], error) {
+	if ds.client == nil {
+		return nil, errNotStarted
+	}
+	if err := ds.require("debug-test", stateAdapterStarted); err != nil {
+		return nil, err
+	}
+	if ds.adapter.name != delveAdapter.name {
+		return nil, fmt.Errorf("debug-test needs the %s adapter, the session uses %s", delveAdapter.name, ds.adapter.name)
+	}
+	if params.Arguments.Package == "" {
+		return nil, errors.New("package is required")
+	}
+	if err := ds.launch(ctx, params.Arguments.programParams(), "test", "unable to launch tests to debug via DAP server"); err != nil {
+		return nil, err
+	}
+	test := params.Arguments
+	ds.config.test = &test
+
+	text := "Started debugging tests in " + params.Arguments.Package
+	if params.Arguments.Run != "" {
+		text += " matching " + params.Arguments.Run
+	}
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: text}},
+	}, nil
+}
+
+// DebugCoreParams defines the parameters for debugging a core dump.
+type DebugCoreParams struct {
+	Path     string `json:"path" mcp:"path to the executable that produced the core dump"`
+	CoreFile string `json:"coreFile" mcp:"path to the core dump"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
+}
+
+// debugCore opens a core dump with the core launch mode of Delve and
+// completes the configuration, since there is nothing to set up before
+// inspecting it. The session is read-only from then on.
+func (ds *debuggerSession) debugCore(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[DebugCoreParams]) (*mcp.CallToolResultFor[any], error) {
+	if ds.client == nil {
+		return nil, errNotStarted
+	}
+	if err := ds.require("debug-core", stateAdapterStarted); err != nil {
+		return nil, err
+	}
+	if ds.adapter.name != delveAdapter.name {
+		return nil, fmt.Errorf("debug-core needs the %s adapter, the session uses %s", delveAdapter.name, ds.adapter.name)
+	}
+	if params.Arguments.Path == "" || params.Arguments.CoreFile == "" {
+		return nil, errors.New("path and coreFile are required")
+	}
+	config := launchConfig{Mode: "core", Program: params.Arguments.Path, CoreFile: params.Arguments.CoreFile}
+	args, err := ds.adapter.launchArguments(config)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := ds.client.LaunchRequest(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateResponse(msg, "unable to open core file via DAP server"); err != nil {
+		return nil, err
+	}
+	ds.coreFile = params.Arguments.CoreFile
+	ds.status.set(stateLaunched)
+
+	msg, err = ds.client.ConfigurationDoneRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateResponse(msg, "unable to complete configuration"); err != nil {
+		return nil, err
+	}
+	// The program of a core dump is stopped for good.
+	ds.status.stopped("core")
+
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Opened core file %s of %s. The session is read-only: use threads, stack-trace, scopes, variables and evaluate to inspect it.", params.Arguments.CoreFile, params.Arguments.Path)}},
+	}, nil
+}
+
+// resumeTimeout is how long execution-control tools wait for the program to stop
+// when the caller does not specify a timeout. It can be configured with the
+// MCP_DAP_RESUME_TIMEOUT environment variable.
+var resumeTimeout = durationFromEnv("MCP_DAP_RESUME_TIMEOUT", time.Minute)
+
+// errStillRunning is returned by resume when the program did not stop before the timeout expired.
+var errStillRunning = errors.New("program is still running")
+
+// resume issues a request that resumes execution and waits until the program
+// stops again or terminates, returning the corresponding StoppedEvent or TerminatedEvent.
+// The subscription is registered before the request is sent so the event cannot be missed.
+// If the program is still running once timeoutSeconds (or resumeTimeout) elapse,
+// resume gives up waiting and returns errStillRunning; the program keeps running
+// and the session remains usable.
+func (ds *debuggerSession) resume(ctx context.Context, timeoutSeconds int, request func(context.Context) (dap.Message, error), errorPrefix string) (dap.EventMessage, error) {
+	return ds.run(ctx, stateRunning, timeoutSeconds, request, errorPrefix)
+}
+
+// run is like resume, but moves the session to state while the request is sent.
+func (ds *debuggerSession) run(ctx context.Context, state sessionState, timeoutSeconds int, request func(context.Context) (dap.Message, error), errorPrefix string) (dap.EventMessage, error) {
+	timeout := resumeTimeout
+	if timeoutSeconds > 0 {
+		timeout = time.Duration(timeoutSeconds) * time.Second
+	}
+
+	stops := make(chan dap.EventMessage, 1)
+	unsubscribe := ds.client.Subscribe(func(event dap.EventMessage) {
+		switch event.(type) {
+		case *dap.StoppedEvent, *dap.TerminatedEvent:
+			select {
+			case stops <- event:
+			default:
 			}
-			return nil
-		case dap.EventMessage:
-			// Continue looping to wait for ResponseMessage
 		}
+	})
+	defer unsubscribe()
+
+	undo := ds.status.begin(state)
+	msg, err := request(ctx)
+	if err != nil {
+		undo()
+		return nil, err
+	}
+	if err := validateResponse(msg, errorPrefix); err != nil {
+		undo()
+		return nil, err
+	}
+	// Let the program be paused and inspected while it runs. The session
+	// fields may change from now on, so the client is not read again.
+	client := ds.client
+	ds.calls.yield()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case event := <-stops:
+		return event, nil
+	case <-client.Done():
+		return nil, client.Err()
+	case <-timer.C:
+		return nil, fmt.Errorf("%w after %s", errStillRunning, timeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// stillRunningResult reports that an execution-control tool stopped waiting
+// while the program kept running.
+func stillRunningResult(err error) *mcp.CallToolResultFor[any] {
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("The %s. Use pause to stop it, or continue to keep waiting.", err)}},
 	}
 }
 
@@ -298,261 +934,403 @@ func readAndValidateResponse(client *DAPClient, errorPrefix string) error {
 type SetBreakpointsParams struct {
 	File  string `json:"file" mcp:"path to the source file"`
 	Lines []int  `json:"lines" mcp:"array of line numbers where to set breakpoints"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
 }
 
 // setBreakpoints sets breakpoints in a source file at specified line numbers.
 func (ds *debuggerSession) setBreakpoints(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[SetBreakpointsParams]) (*mcp.CallToolResultFor[any], error) {
 	if ds.client == nil {
-		return nil, fmt.Errorf("debugger not started")
+		return nil, errNotStarted
 	}
-	if err := ds.client.SetBreakpointsRequest(params.Arguments.File, params.Arguments.Lines); err != nil {
+	if err := ds.canExecute("set-breakpoints"); err != nil {
 		return nil, err
 	}
-	msg, err := ds.client.ReadMessage()
+	if err := ds.require("set-breakpoints", liveStates...); err != nil {
+		return nil, err
+	}
+	msg, err := ds.client.SetBreakpointsRequest(ctx, params.Arguments.File, params.Arguments.Lines)
 	if err != nil {
 		return nil, err
 	}
-	switch response := msg.(type) {
-	case *dap.SetBreakpointsResponse:
-		var breakpoints strings.Builder
-		for _, bp := range response.Body.Breakpoints {
-			breakpoints.WriteString("Breakpoint ")
-			if bp.Verified {
-				breakpoints.WriteString(fmt.Sprintf("created at %s:%d with ID %d", bp.Source.Path, bp.Line, bp.Id))
-			} else {
-				breakpoints.WriteString("unable to be created: ")
-				breakpoints.WriteString(bp.Message)
-			}
-		}
+	if err := validateResponse(msg, "unable to set breakpoints"); err != nil {
+		return nil, err
+	}
+	response, ok := msg.(*dap.SetBreakpointsResponse)
+	if !ok {
+		return nil, unexpectedResponse(msg, "unable to set breakpoints")
+	}
 
-		return &mcp.CallToolResultFor[any]{
-			Content: []mcp.Content{&mcp.TextContent{Text: breakpoints.String()}},
-		}, nil
-	case *dap.ErrorResponse:
-		return nil, errors.New(response.Message)
-	default:
-		return nil, errors.New("unexpected DAP response from set breakpoints request")
+	if ds.breakpoints == nil {
+		ds.breakpoints = make(map[string][]int)
+	}
+	if len(params.Arguments.Lines) > 0 {
+		ds.breakpoints[params.Arguments.File] = params.Arguments.Lines
+	} else {
+		delete(ds.breakpoints, params.Arguments.File)
 	}
+
+	var breakpoints strings.Builder
+	for _, bp := range response.Body.Breakpoints {
+		breakpoints.WriteString(formatBreakpoint(bp))
+	}
+
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: breakpoints.String()}},
+	}, nil
+}
+
+// formatBreakpoint describes bp and whether the adapter could set it.
+func formatBreakpoint(bp dap.Breakpoint) string {
+	if !bp.Verified {
+		return "Breakpoint unable to be created: " + bp.Message
+	}
+	location := fmt.Sprintf("line %d", bp.Line)
+	if bp.Source != nil {
+		location = fmt.Sprintf("%s:%d", bp.Source.Path, bp.Line)
+	}
+	return fmt.Sprintf("Breakpoint created at %s with ID %d", location, bp.Id)
 }
 
 // SetFunctionBreakpointsParams defines the parameters for setting function breakpoints.
 type SetFunctionBreakpointsParams struct {
 	Functions []string `json:"functions" mcp:"array of function names where to set breakpoints"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
 }
 
 // setFunctionBreakpoints sets breakpoints on functions by name.
 func (ds *debuggerSession) setFunctionBreakpoints(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[SetFunctionBreakpointsParams]) (*mcp.CallToolResultFor[any], error) {
 	if ds.client == nil {
-		return nil, fmt.Errorf("debugger not started")
+		return nil, errNotStarted
+	}
+	if err := ds.canExecute("set-function-breakpoints"); err != nil {
+		return nil, err
+	}
+	if err := ds.supports("setFunctionBreakpoints"); err != nil {
+		return nil, err
 	}
-	if err := ds.client.SetFunctionBreakpointsRequest(params.Arguments.Functions); err != nil {
+	if err := ds.require("set-function-breakpoints", liveStates...); err != nil {
+		return nil, err
+	}
+	msg, err := ds.client.SetFunctionBreakpointsRequest(ctx, params.Arguments.Functions)
+	if err != nil {
 		return nil, err
 	}
-	if err := readAndValidateResponse(ds.client, "unable to set function breakpoints"); err != nil {
+	if err := validateResponse(msg, "unable to set function breakpoints"); err != nil {
 		return nil, err
 	}
+	ds.functionBreakpoints = params.Arguments.Functions
 
 	return &mcp.CallToolResultFor[any]{
 		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Set breakpoints on %d functions", len(params.Arguments.Functions))}},
 	}, nil
 }
 
+// SetExceptionBreakpointsParams defines the parameters for setting exception breakpoints.
+type SetExceptionBreakpointsParams struct {
+	Filters []string `json:"filters" mcp:"exception filters to enable, e.g. raised and uncaught for debugpy; an empty list disables breaking on exceptions"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
+}
+
+// setExceptionBreakpoints configures on which exceptions the program stops.
+// The filters must be among those the adapter advertised in its capabilities.
+func (ds *debuggerSession) setExceptionBreakpoints(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[SetExceptionBreakpointsParams]) (*mcp.CallToolResultFor[any], error) {
+	if ds.client == nil {
+		return nil, errNotStarted
+	}
+	if err := ds.canExecute("set-exception-breakpoints"); err != nil {
+		return nil, err
+	}
+	if err := ds.supports("setExceptionBreakpoints"); err != nil {
+		return nil, err
+	}
+	if err := ds.require("set-exception-breakpoints", liveStates...); err != nil {
+		return nil, err
+	}
+	var available []string
+	for _, filter := range ds.capabilities.ExceptionBreakpointFilters {
+		available = append(available, filter.Filter)
+	}
+	for _, filter := range params.Arguments.Filters {
+		if !slices.Contains(available, filter) {
+			return nil, fmt.Errorf("unknown exception filter %q: this adapter supports %s", filter, strings.Join(available, ", "))
+		}
+	}
+	msg, err := ds.client.SetExceptionBreakpointsRequest(ctx, params.Arguments.Filters)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateResponse(msg, "unable to set exception breakpoints"); err != nil {
+		return nil, err
+	}
+	ds.exceptionFilters = params.Arguments.Filters
+
+	text := "Disabled exception breakpoints"
+	if len(params.Arguments.Filters) > 0 {
+		text = "Enabled exception filters: " + strings.Join(params.Arguments.Filters, ", ")
+	}
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: text}},
+	}, nil
+}
+
 // ConfigurationDoneParams defines the parameters for configuration done.
 type ConfigurationDoneParams struct {
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
 }
 
 // configurationDone indicates that configuration is complete and debugging can begin.
 func (ds *debuggerSession) configurationDone(ctx context.Context, _ *mcp.ServerSession, _ *mcp.CallToolParamsFor[ConfigurationDoneParams]) (*mcp.CallToolResultFor[any], error) {
 	if ds.client == nil {
-		return nil, fmt.Errorf("debugger not started")
+		return nil, errNotStarted
+	}
+	if err := ds.canExecute("configuration-done"); err != nil {
+		return nil, err
 	}
-	if err := ds.client.ConfigurationDoneRequest(); err != nil {
+	if err := ds.supports("configurationDone"); err != nil {
 		return nil, err
 	}
-	if err := readAndValidateResponse(ds.client, "unable to complete configuration"); err != nil {
+	if err := ds.require("configuration-done", stateLaunched); err != nil {
 		return nil, err
 	}
+	if !ds.config.stopsOnEntry() {
+		undo := ds.status.begin(stateConfigured)
+		msg, err := ds.configure(ctx)
+		if err != nil {
+			undo()
+			return nil, err
+		}
+		if err := validateResponse(msg, "unable to complete configuration"); err != nil {
+			undo()
+			return nil, err
+		}
+		return &mcp.CallToolResultFor[any]{
+			Content: []mcp.Content{&mcp.TextContent{Text: "Configuration done, debugging can begin"}},
+		}, nil
+	}
 
+	// The adapter answers before the program stops on entry: wait for the
+	// stop so that the tools inspecting the program can be used right away.
+	event, err := ds.run(ctx, stateConfigured, 0, ds.configure, "unable to complete configuration")
+	if err != nil && !errors.Is(err, errStillRunning) {
+		return nil, err
+	}
+	text := "Configuration done, debugging can begin"
+	if stopped, ok := event.(*dap.StoppedEvent); ok {
+		text += fmt.Sprintf("\nProgram stopped on entry in thread %d", stopped.Body.ThreadId)
+	}
 	return &mcp.CallToolResultFor[any]{
-		Content: []mcp.Content{&mcp.TextContent{Text: "Configuration done, debugging can begin"}},
+		Content: []mcp.Content{&mcp.TextContent{Text: text}},
 	}, nil
 }
 
 // ContinueParams defines the parameters for continuing execution.
 type ContinueParams struct {
-	ThreadID int `json:"threadId" mcp:"thread ID to continue, or 0 for all threads"`
+	ThreadID       int `json:"threadId" mcp:"thread ID to continue, or 0 for all threads"`
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty" mcp:"how long to wait for the program to stop before returning (default: 60)"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
 }
 
 // continueExecution continues execution of the debugged program.
 func (ds *debuggerSession) continueExecution(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[ContinueParams]) (*mcp.CallToolResultFor[any], error) {
 	if ds.client == nil {
-		return nil, fmt.Errorf("debugger not started")
+		return nil, errNotStarted
 	}
-	if err := ds.client.ContinueRequest(params.Arguments.ThreadID); err != nil {
+	if err := ds.canExecute("continue"); err != nil {
 		return nil, err
 	}
-	for {
-		msg, err := ds.client.ReadMessage()
-		if err != nil {
-			return nil, err
-		}
-		switch resp := msg.(type) {
-		case dap.ResponseMessage:
-			if !resp.GetResponse().Success {
-				return nil, fmt.Errorf("%s: %s", "unable to continue", resp.GetResponse().Message)
-			}
-		case *dap.StoppedEvent:
-			msg := resp.Body
-			var response string
-			response = formatStoppedResponse(msg)
-			return &mcp.CallToolResultFor[any]{
-				Content: []mcp.Content{&mcp.TextContent{Text: "Continued execution...\n" + response}},
-			}, nil
-		case *dap.TerminatedEvent:
-			return &mcp.CallToolResultFor[any]{
-				Content: []mcp.Content{&mcp.TextContent{Text: "Continued execution to program termination"}},
-			}, nil
+	if err := ds.require("continue", resumeStates...); err != nil {
+		return nil, err
+	}
+	if err := ds.requireConfigurationDone("continue"); err != nil {
+		return nil, err
+	}
+	event, err := ds.resume(ctx, params.Arguments.TimeoutSeconds, func(ctx context.Context) (dap.Message, error) {
+		return ds.client.ContinueRequest(ctx, params.Arguments.ThreadID)
+	}, "unable to continue")
+	if err != nil {
+		if errors.Is(err, errStillRunning) {
+			return stillRunningResult(err), nil
 		}
+		return nil, err
+	}
+	if stopped, ok := event.(*dap.StoppedEvent); ok {
+		return &mcp.CallToolResultFor[any]{
+			Content: []mcp.Content{&mcp.TextContent{Text: "Continued execution...\n" + formatStoppedResponse(stopped.Body)}},
+		}, nil
 	}
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: "Continued execution to program termination"}},
+	}, nil
 }
 
 func formatStoppedResponse(msg dap.StoppedEventBody) string {
 	switch msg.Reason {
 	case "breakpoint", "function breakpoint":
+		// Not every adapter reports which breakpoints were hit.
+		if len(msg.HitBreakpointIds) == 0 {
+			return fmt.Sprintf("Program stopped as a result of hitting a breakpoint by thread %d", msg.ThreadId)
+		}
 		return fmt.Sprintf("Program stopped as a result of hitting breakpoint %d hit by thread %d", msg.HitBreakpointIds[0], msg.ThreadId)
-
+	case "exception":
+		text := msg.Text
+		if text == "" {
+			text = msg.Description
+		}
+		return fmt.Sprintf("Program stopped on exception in thread %d: %s", msg.ThreadId, text)
 	}
 	return "Program stopped for unknown reason."
 }
 
 // NextParams defines the parameters for stepping to the next line.
 type NextParams struct {
-	ThreadID int `json:"threadId" mcp:"thread ID to step"`
+	ThreadID       int `json:"threadId" mcp:"thread ID to step"`
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty" mcp:"how long to wait for the program to stop before returning (default: 60)"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
 }
 
 // nextStep steps over the next line of code.
 func (ds *debuggerSession) nextStep(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[NextParams]) (*mcp.CallToolResultFor[any], error) {
 	if ds.client == nil {
-		return nil, fmt.Errorf("debugger not started")
+		return nil, errNotStarted
 	}
-	if err := ds.client.NextRequest(params.Arguments.ThreadID); err != nil {
+	if err := ds.canExecute("next"); err != nil {
 		return nil, err
 	}
-	for {
-		msg, err := ds.client.ReadMessage()
-		if err != nil {
-			return nil, err
-		}
-		switch resp := msg.(type) {
-		case dap.ResponseMessage:
-			if !resp.GetResponse().Success {
-				return nil, fmt.Errorf("%s: %s", "unable to step to next line", resp.GetResponse().Message)
-			}
-		case *dap.StoppedEvent:
-			msg := resp.Body
-			var response string
-			response = formatStoppedResponse(msg)
-			return &mcp.CallToolResultFor[any]{
-				Content: []mcp.Content{&mcp.TextContent{Text: "Stepped to next line...\n" + response}},
-			}, nil
-		case *dap.TerminatedEvent:
-			return &mcp.CallToolResultFor[any]{
-				Content: []mcp.Content{&mcp.TextContent{Text: "Stepped to program termination"}},
-			}, nil
+	if err := ds.require("next", resumeStates...); err != nil {
+		return nil, err
+	}
+	if err := ds.requireConfigurationDone("next"); err != nil {
+		return nil, err
+	}
+	event, err := ds.resume(ctx, params.Arguments.TimeoutSeconds, func(ctx context.Context) (dap.Message, error) {
+		return ds.client.NextRequest(ctx, params.Arguments.ThreadID)
+	}, "unable to step to next line")
+	if err != nil {
+		if errors.Is(err, errStillRunning) {
+			return stillRunningResult(err), nil
 		}
+		return nil, err
+	}
+	if stopped, ok := event.(*dap.StoppedEvent); ok {
+		return &mcp.CallToolResultFor[any]{
+			Content: []mcp.Content{&mcp.TextContent{Text: "Stepped to next line...\n" + formatStoppedResponse(stopped.Body)}},
+		}, nil
 	}
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: "Stepped to program termination"}},
+	}, nil
 }
 
 // StepInParams defines the parameters for stepping into a function.
 type StepInParams struct {
-	ThreadID int `json:"threadId" mcp:"thread ID to step"`
+	ThreadID       int `json:"threadId" mcp:"thread ID to step"`
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty" mcp:"how long to wait for the program to stop before returning (default: 60)"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
 }
 
 // stepIn steps into a function call.
 func (ds *debuggerSession) stepIn(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[StepInParams]) (*mcp.CallToolResultFor[any], error) {
 	if ds.client == nil {
-		return nil, fmt.Errorf("debugger not started")
+		return nil, errNotStarted
 	}
-	if err := ds.client.StepInRequest(params.Arguments.ThreadID); err != nil {
+	if err := ds.canExecute("step-in"); err != nil {
 		return nil, err
 	}
-	for {
-		msg, err := ds.client.ReadMessage()
-		if err != nil {
-			return nil, err
-		}
-		switch resp := msg.(type) {
-		case dap.ResponseMessage:
-			if !resp.GetResponse().Success {
-				return nil, fmt.Errorf("%s: %s", "unable to step into function", resp.GetResponse().Message)
-			}
-		case *dap.StoppedEvent:
-			msg := resp.Body
-			var response string
-			response = formatStoppedResponse(msg)
-			return &mcp.CallToolResultFor[any]{
-				Content: []mcp.Content{&mcp.TextContent{Text: "Stepped into function...\n" + response}},
-			}, nil
-		case *dap.TerminatedEvent:
-			return &mcp.CallToolResultFor[any]{
-				Content: []mcp.Content{&mcp.TextContent{Text: "Stepped to program termination"}},
-			}, nil
+	if err := ds.require("step-in", resumeStates...); err != nil {
+		return nil, err
+	}
+	if err := ds.requireConfigurationDone("step-in"); err != nil {
+		return nil, err
+	}
+	event, err := ds.resume(ctx, params.Arguments.TimeoutSeconds, func(ctx context.Context) (dap.Message, error) {
+		return ds.client.StepInRequest(ctx, params.Arguments.ThreadID)
+	}, "unable to step into function")
+	if err != nil {
+		if errors.Is(err, errStillRunning) {
+			return stillRunningResult(err), nil
 		}
+		return nil, err
 	}
+	if stopped, ok := event.(*dap.StoppedEvent); ok {
+		return &mcp.CallToolResultFor[any]{
+			Content: []mcp.Content{&mcp.TextContent{Text: "Stepped into function...\n" + formatStoppedResponse(stopped.Body)}},
+		}, nil
+	}
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: "Stepped to program termination"}},
+	}, nil
 }
 
 // StepOutParams defines the parameters for stepping out of a function.
 type StepOutParams struct {
-	ThreadID int `json:"threadId" mcp:"thread ID to step"`
+	ThreadID       int `json:"threadId" mcp:"thread ID to step"`
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty" mcp:"how long to wait for the program to stop before returning (default: 60)"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
 }
 
 // stepOut steps out of the current function.
 func (ds *debuggerSession) stepOut(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[StepOutParams]) (*mcp.CallToolResultFor[any], error) {
 	if ds.client == nil {
-		return nil, fmt.Errorf("debugger not started")
+		return nil, errNotStarted
 	}
-	if err := ds.client.StepOutRequest(params.Arguments.ThreadID); err != nil {
+	if err := ds.canExecute("step-out"); err != nil {
 		return nil, err
 	}
-	for {
-		msg, err := ds.client.ReadMessage()
-		if err != nil {
-			return nil, err
-		}
-		switch resp := msg.(type) {
-		case dap.ResponseMessage:
-			if !resp.GetResponse().Success {
-				return nil, fmt.Errorf("%s: %s", "unable to step out of function", resp.GetResponse().Message)
-			}
-		case *dap.StoppedEvent:
-			msg := resp.Body
-			var response string
-			response = formatStoppedResponse(msg)
-			return &mcp.CallToolResultFor[any]{
-				Content: []mcp.Content{&mcp.TextContent{Text: "Stepped out of function...\n" + response}},
-			}, nil
-		case *dap.TerminatedEvent:
-			return &mcp.CallToolResultFor[any]{
-				Content: []mcp.Content{&mcp.TextContent{Text: "Stepped to program termination"}},
-			}, nil
+	if err := ds.require("step-out", resumeStates...); err != nil {
+		return nil, err
+	}
+	if err := ds.requireConfigurationDone("step-out"); err != nil {
+		return nil, err
+	}
+	event, err := ds.resume(ctx, params.Arguments.TimeoutSeconds, func(ctx context.Context) (dap.Message, error) {
+		return ds.client.StepOutRequest(ctx, params.Arguments.ThreadID)
+	}, "unable to step out of function")
+	if err != nil {
+		if errors.Is(err, errStillRunning) {
+			return stillRunningResult(err), nil
 		}
+		return nil, err
 	}
+	if stopped, ok := event.(*dap.StoppedEvent); ok {
+		return &mcp.CallToolResultFor[any]{
+			Content: []mcp.Content{&mcp.TextContent{Text: "Stepped out of function...\n" + formatStoppedResponse(stopped.Body)}},
+		}, nil
+	}
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: "Stepped to program termination"}},
+	}, nil
 }
 
 // PauseParams defines the parameters for pausing execution.
 type PauseParams struct {
 	ThreadID int `json:"threadId" mcp:"thread ID to pause"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
 }
 
 // pauseExecution pauses execution of a thread.
 func (ds *debuggerSession) pauseExecution(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[PauseParams]) (*mcp.CallToolResultFor[any], error) {
 	if ds.client == nil {
-		return nil, fmt.Errorf("debugger not started")
+		return nil, errNotStarted
 	}
-	if err := ds.client.PauseRequest(params.Arguments.ThreadID); err != nil {
+	if err := ds.canExecute("pause"); err != nil {
+		return nil, err
+	}
+	if err := ds.require("pause", stateConfigured, stateRunning); err != nil {
+		return nil, err
+	}
+	msg, err := ds.client.PauseRequest(ctx, params.Arguments.ThreadID)
+	if err != nil {
 		return nil, err
 	}
-	if err := readAndValidateResponse(ds.client, "unable to pause execution"); err != nil {
+	if err := validateResponse(msg, "unable to pause execution"); err != nil {
 		return nil, err
 	}
 
@@ -563,34 +1341,31 @@ func (ds *debuggerSession) pauseExecution(ctx context.Context, _ *mcp.ServerSess
 
 // ThreadsParams defines the parameters for listing threads.
 type ThreadsParams struct {
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
 }
 
 // listThreads lists all threads in the debugged program.
 func (ds *debuggerSession) listThreads(ctx context.Context, _ *mcp.ServerSession, _ *mcp.CallToolParamsFor[ThreadsParams]) (*mcp.CallToolResultFor[any], error) {
 	if ds.client == nil {
-		return nil, fmt.Errorf("debugger not started")
+		return nil, errNotStarted
 	}
-	if err := ds.client.ThreadsRequest(); err != nil {
+	if err := ds.require("threads", liveStates...); err != nil {
 		return nil, err
 	}
-	msg, err := ds.client.ReadMessage()
+	msg, err := ds.client.ThreadsRequest(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	// Parse threads response
-	if resp, ok := msg.(dap.ResponseMessage); ok {
-		if !resp.GetResponse().Success {
-			return nil, fmt.Errorf("unable to get threads: %s", resp.GetResponse().Message)
-		}
-		// Format thread information
-		// Note: The actual thread data would need to be extracted from the response body
-		return &mcp.CallToolResultFor[any]{
-			Content: []mcp.Content{&mcp.TextContent{Text: "Retrieved thread list"}},
-		}, nil
+	if err := validateResponse(msg, "unable to get threads"); err != nil {
+		return nil, err
 	}
-
-	return nil, fmt.Errorf("unexpected response type")
+	// Format thread information
+	// Note: The actual thread data would need to be extracted from the response body
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: "Retrieved thread list"}},
+	}, nil
 }
 
 // StackTraceParams defines the parameters for getting a stack trace.
@@ -598,12 +1373,17 @@ type StackTraceParams struct {
 	ThreadID   int `json:"threadId" mcp:"thread ID to get stack trace for"`
 	StartFrame int `json:"startFrame" mcp:"starting frame index (default: 0)"`
 	Levels     int `json:"levels" mcp:"maximum number of frames to return (default: 20)"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
 }
 
 // getStackTrace gets the stack trace for a thread.
 func (ds *debuggerSession) getStackTrace(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[StackTraceParams]) (*mcp.CallToolResultFor[any], error) {
 	if ds.client == nil {
-		return nil, fmt.Errorf("debugger not started")
+		return nil, errNotStarted
+	}
+	if err := ds.require("stack-trace", stateStopped); err != nil {
+		return nil, err
 	}
 
 	levels := params.Arguments.Levels
@@ -611,65 +1391,52 @@ func (ds *debuggerSession) getStackTrace(ctx context.Context, _ *mcp.ServerSessi
 		levels = 20
 	}
 
-	if err := ds.client.StackTraceRequest(params.Arguments.ThreadID, params.Arguments.StartFrame, levels); err != nil {
+	msg, err := ds.client.StackTraceRequest(ctx, params.Arguments.ThreadID, params.Arguments.StartFrame, levels)
+	if err != nil {
 		return nil, err
 	}
 
-	// Read messages until we get the stack trace response
-	for {
-		msg, err := ds.client.ReadMessage()
-		if err != nil {
-			return nil, err
-		}
-
-		switch resp := msg.(type) {
-		case *dap.StackTraceResponse:
-			if !resp.Success {
-				return nil, fmt.Errorf("unable to get stack trace: %s", resp.Message)
-			}
-
-			var stackTrace strings.Builder
-			stackTrace.WriteString(fmt.Sprintf("Stack trace for thread %d:\n", params.Arguments.ThreadID))
-
-			for i, frame := range resp.Body.StackFrames {
-				stackTrace.WriteString(fmt.Sprintf("\n#%d (Frame ID: %d) %s", i, frame.Id, frame.Name))
-				if frame.Source != nil && frame.Source.Path != "" {
-					stackTrace.WriteString(fmt.Sprintf("\n   at %s:%d", frame.Source.Path, frame.Line))
-					if frame.Column > 0 {
-						stackTrace.WriteString(fmt.Sprintf(":%d", frame.Column))
-					}
-				}
-				if frame.PresentationHint == "subtle" {
-					stackTrace.WriteString(" (runtime)")
+	if err := validateResponse(msg, "unable to get stack trace"); err != nil {
+		return nil, err
+	}
+	switch resp := msg.(type) {
+	case *dap.StackTraceResponse:
+		var stackTrace strings.Builder
+		stackTrace.WriteString(fmt.Sprintf("Stack trace for thread %d:\n", params.Arguments.ThreadID))
+
+		for i, frame := range resp.Body.StackFrames {
+			stackTrace.WriteString(fmt.Sprintf("\n#%d (Frame ID: %d) %s", i, frame.Id, frame.Name))
+			if frame.Source != nil && frame.Source.Path != "" {
+				stackTrace.WriteString(fmt.Sprintf("\n   at %s:%d", frame.Source.Path, frame.Line))
+				if frame.Column > 0 {
+					stackTrace.WriteString(fmt.Sprintf(":%d", frame.Column))
 				}
-				stackTrace.WriteString("\n")
 			}
+			if frame.PresentationHint == "subtle" {
+				stackTrace.WriteString(" (runtime)")
+			}
+			if frame.InstructionPointerReference != "" {
+				stackTrace.WriteString(fmt.Sprintf("\n   pc %s", frame.InstructionPointerReference))
+			}
+			stackTrace.WriteString("\n")
+		}
 
-			stackTrace.WriteString(fmt.Sprintf("\nTotal frames: %d", resp.Body.TotalFrames))
-
-			return &mcp.CallToolResultFor[any]{
-				Content: []mcp.Content{&mcp.TextContent{Text: stackTrace.String()}},
-			}, nil
-
-		case dap.EventMessage:
-			// Continue looping to wait for StackTraceResponse
-			continue
+		stackTrace.WriteString(fmt.Sprintf("\nTotal frames: %d", resp.Body.TotalFrames))
 
-		case dap.ResponseMessage:
-			if !resp.GetResponse().Success {
-				return nil, fmt.Errorf("unable to get stack trace: %s", resp.GetResponse().Message)
-			}
-			return nil, fmt.Errorf("received generic response instead of StackTraceResponse")
+		return &mcp.CallToolResultFor[any]{
+			Content: []mcp.Content{&mcp.TextContent{Text: stackTrace.String()}},
+		}, nil
 
-		default:
-			return nil, fmt.Errorf("unexpected response type: %T", msg)
-		}
+	default:
+		return nil, unexpectedResponse(msg, "unable to get stack trace")
 	}
 }
 
 // ScopesParams defines the parameters for getting scopes.
 type ScopesParams struct {
 	FrameID int `json:"frameId" mcp:"stack frame ID"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
 }
 
 // getScopes gets the scopes for a stack frame.
@@ -681,21 +1448,20 @@ type ScopesParams struct {
 // Returns a formatted text representation of the scopes and their variables.
 func (ds *debuggerSession) getScopes(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[ScopesParams]) (*mcp.CallToolResultFor[any], error) {
 	if ds.client == nil {
-		return nil, fmt.Errorf("debugger not started")
+		return nil, errNotStarted
 	}
-	if err := ds.client.ScopesRequest(params.Arguments.FrameID); err != nil {
+	if err := ds.require("scopes", stateStopped); err != nil {
 		return nil, err
 	}
-	msg, err := ds.client.ReadMessage()
+	msg, err := ds.client.ScopesRequest(ctx, params.Arguments.FrameID)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := validateResponse(msg, "unable to get scopes"); err != nil {
+		return nil, err
+	}
 	if resp, ok := msg.(*dap.ScopesResponse); ok {
-		if !resp.Success {
-			return nil, fmt.Errorf("unable to get scopes: %s", resp.Message)
-		}
-
 		var result strings.Builder
 		result.WriteString(fmt.Sprintf("Scopes for frame %d:\n", params.Arguments.FrameID))
 
@@ -709,17 +1475,15 @@ func (ds *debuggerSession) getScopes(ctx context.Context, _ *mcp.ServerSession,
 			// If the scope has variables, we can fetch them
 			if scope.VariablesReference > 0 {
 				// Request variables for this scope
-				if err := ds.client.VariablesRequest(scope.VariablesReference); err == nil {
-					if varMsg, err := ds.client.ReadMessage(); err == nil {
-						if varResp, ok := varMsg.(*dap.VariablesResponse); ok && varResp.Success {
-							// Format variables
-							for _, variable := range varResp.Body.Variables {
-								result.WriteString(fmt.Sprintf("  %s", variable.Name))
-								if variable.Type != "" {
-									result.WriteString(fmt.Sprintf(" (%s)", variable.Type))
-								}
-								result.WriteString(fmt.Sprintf(" = %s\n", variable.Value))
+				if varMsg, err := ds.client.VariablesRequest(ctx, scope.VariablesReference); err == nil {
+					if varResp, ok := varMsg.(*dap.VariablesResponse); ok && varResp.Success {
+						// Format variables
+						for _, variable := range varResp.Body.Variables {
+							result.WriteString(fmt.Sprintf("  %s", variable.Name))
+							if variable.Type != "" {
+								result.WriteString(fmt.Sprintf(" (%s)", variable.Type))
 							}
+							result.WriteString(fmt.Sprintf(" = %s\n", variable.Value))
 						}
 					}
 				}
@@ -731,37 +1495,35 @@ func (ds *debuggerSession) getScopes(ctx context.Context, _ *mcp.ServerSession,
 		}, nil
 	}
 
-	return nil, fmt.Errorf("unexpected response type")
+	return nil, unexpectedResponse(msg, "unable to get scopes")
 }
 
 // VariablesParams defines the parameters for getting variables.
 type VariablesParams struct {
 	VariablesReference int `json:"variablesReference" mcp:"reference to the variable container"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
 }
 
 // getVariables gets variables in a scope.
 func (ds *debuggerSession) getVariables(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[VariablesParams]) (*mcp.CallToolResultFor[any], error) {
 	if ds.client == nil {
-		return nil, fmt.Errorf("debugger not started")
+		return nil, errNotStarted
 	}
-	if err := ds.client.VariablesRequest(params.Arguments.VariablesReference); err != nil {
+	if err := ds.require("variables", stateStopped); err != nil {
 		return nil, err
 	}
-	msg, err := ds.client.ReadMessage()
+	msg, err := ds.client.VariablesRequest(ctx, params.Arguments.VariablesReference)
 	if err != nil {
 		return nil, err
 	}
 
-	if resp, ok := msg.(dap.ResponseMessage); ok {
-		if !resp.GetResponse().Success {
-			return nil, fmt.Errorf("unable to get variables: %s", resp.GetResponse().Message)
-		}
-		return &mcp.CallToolResultFor[any]{
-			Content: []mcp.Content{&mcp.TextContent{Text: "Retrieved variables"}},
-		}, nil
+	if err := validateResponse(msg, "unable to get variables"); err != nil {
+		return nil, err
 	}
-
-	return nil, fmt.Errorf("unexpected response type")
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: "Retrieved variables"}},
+	}, nil
 }
 
 // EvaluateParams defines the parameters for evaluating an expression.
@@ -769,12 +1531,17 @@ type EvaluateParams struct {
 	Expression string `json:"expression" mcp:"expression to evaluate"`
 	FrameID    int    `json:"frameId" mcp:"stack frame ID for evaluation context"`
 	Context    string `json:"context" mcp:"context for evaluation (watch, repl, hover)"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
 }
 
 // evaluateExpression evaluates an expression in the context of a stack frame.
 func (ds *debuggerSession) evaluateExpression(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[EvaluateParams]) (*mcp.CallToolResultFor[any], error) {
 	if ds.client == nil {
-		return nil, fmt.Errorf("debugger not started")
+		return nil, errNotStarted
+	}
+	if err := ds.require("evaluate", stateStopped); err != nil {
+		return nil, err
 	}
 
 	context := params.Arguments.Context
@@ -782,36 +1549,25 @@ func (ds *debuggerSession) evaluateExpression(ctx context.Context, _ *mcp.Server
 		context = "repl"
 	}
 
-	if err := ds.client.EvaluateRequest(params.Arguments.Expression, params.Arguments.FrameID, context); err != nil {
+	msg, err := ds.client.EvaluateRequest(ctx, params.Arguments.Expression, params.Arguments.FrameID, context)
+	if err != nil {
 		return nil, err
 	}
 
-	// Read messages until we get the EvaluateResponse
-	// Events can come at any time, so we need to handle them
-	for {
-		msg, err := ds.client.ReadMessage()
-		if err != nil {
-			return nil, err
-		}
-
-		switch resp := msg.(type) {
-		case *dap.EvaluateResponse:
-			if !resp.Success {
-				return nil, fmt.Errorf("unable to evaluate expression: %s", resp.Message)
-			}
-			result := fmt.Sprintf("%s", resp.Body.Result)
-			if resp.Body.Type != "" {
-				result = fmt.Sprintf("%s (type: %s)", resp.Body.Result, resp.Body.Type)
-			}
-			return &mcp.CallToolResultFor[any]{
-				Content: []mcp.Content{&mcp.TextContent{Text: result}},
-			}, nil
-		case dap.EventMessage:
-			// Ignore events, they can come at any time
-			continue
-		default:
-			return nil, fmt.Errorf("unexpected response type: %T", msg)
+	if err := validateResponse(msg, "unable to evaluate expression"); err != nil {
+		return nil, err
+	}
+	switch resp := msg.(type) {
+	case *dap.EvaluateResponse:
+		result := fmt.Sprintf("%s", resp.Body.Result)
+		if resp.Body.Type != "" {
+			result = fmt.Sprintf("%s (type: %s)", resp.Body.Result, resp.Body.Type)
 		}
+		return &mcp.CallToolResultFor[any]{
+			Content: []mcp.Content{&mcp.TextContent{Text: result}},
+		}, nil
+	default:
+		return nil, unexpectedResponse(msg, "unable to evaluate expression")
 	}
 }
 
@@ -820,75 +1576,206 @@ type SetVariableParams struct {
 	VariablesReference int    `json:"variablesReference" mcp:"reference to the variable container"`
 	Name               string `json:"name" mcp:"name of the variable to set"`
 	Value              string `json:"value" mcp:"new value for the variable"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
 }
 
 // setVariable sets the value of a variable in the debugged program.
 func (ds *debuggerSession) setVariable(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[SetVariableParams]) (*mcp.CallToolResultFor[any], error) {
 	if ds.client == nil {
-		return nil, fmt.Errorf("debugger not started")
+		return nil, errNotStarted
+	}
+	if err := ds.canExecute("set-variable"); err != nil {
+		return nil, err
 	}
-	if err := ds.client.SetVariableRequest(params.Arguments.VariablesReference, params.Arguments.Name, params.Arguments.Value); err != nil {
+	if err := ds.supports("setVariable"); err != nil {
 		return nil, err
 	}
-	msg, err := ds.client.ReadMessage()
+	if err := ds.require("set-variable", stateStopped); err != nil {
+		return nil, err
+	}
+	msg, err := ds.client.SetVariableRequest(ctx, params.Arguments.VariablesReference, params.Arguments.Name, params.Arguments.Value)
 	if err != nil {
 		return nil, err
 	}
 
-	if resp, ok := msg.(dap.ResponseMessage); ok {
-		if !resp.GetResponse().Success {
-			return nil, fmt.Errorf("unable to set variable: %s", resp.GetResponse().Message)
-		}
-		return &mcp.CallToolResultFor[any]{
-			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Set variable %s to %s", params.Arguments.Name, params.Arguments.Value)}},
-		}, nil
+	if err := validateResponse(msg, "unable to set variable"); err != nil {
+		return nil, err
 	}
-
-	return nil, fmt.Errorf("unexpected response type")
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Set variable %s to %s", params.Arguments.Name, params.Arguments.Value)}},
+	}, nil
 }
 
 // RestartParams defines the parameters for restarting the debugger.
 type RestartParams struct {
-	Args []string `json:"args,omitempty" mcp:"new command line arguments for the program upon restart, or empty to reuse previous arguments"`
+	Args []string          `json:"args,omitempty" mcp:"new command line arguments for the program upon restart, or empty to reuse previous arguments; for debug-test, they replace its args only"`
+	Env  map[string]string `json:"env,omitempty" mcp:"environment variables added to or replacing those of the previous launch"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
 }
 
 // restartDebugger restarts the debugging session.
+// It replays the launch or attach request of the session, with the arguments
+// and environment overridden if requested, then re-applies the breakpoints.
 func (ds *debuggerSession) restartDebugger(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[RestartParams]) (*mcp.CallToolResultFor[any], error) {
 	if ds.client == nil {
-		return nil, fmt.Errorf("debugger not started")
-	}
-	if err := ds.client.RestartRequest(map[string]any{
-		"arguments": map[string]any{
-			"request":     "launch",
-			"mode":        "exec",
-			"stopOnEntry": false,
-			"args":        params.Arguments.Args,
-		},
-	}); err != nil {
+		return nil, errNotStarted
+	}
+	if err := ds.canExecute("restart"); err != nil {
+		return nil, err
+	}
+	if err := ds.supports("restart"); err != nil {
+		return nil, err
+	}
+	if err := ds.require("restart", restartStates...); err != nil {
+		return nil, err
+	}
+	if err := ds.requireConfigurationDone("restart"); err != nil {
+		return nil, err
+	}
+	if ds.config == nil {
+		return nil, errors.New("nothing to restart: no program was launched or attached to")
+	}
+	config := *ds.config
+	if len(params.Arguments.Args) > 0 || len(params.Arguments.Env) > 0 {
+		if config.request != "launch" {
+			return nil, errors.New("args and env can only be changed when restarting a launched program")
+		}
+		if len(params.Arguments.Env) > 0 && ds.adapter.restartKeepsEnv {
+			return nil, fmt.Errorf("changing env on restart is %w: %s keeps the environment of the first launch; stop the debugger and start it again instead", errNotSupported, ds.adapter.name)
+		}
+		if len(params.Arguments.Args) > 0 {
+			config.program.Args = params.Arguments.Args
+			// The arguments of a test binary also select the tests to run,
+			// which are kept.
+			if config.test != nil {
+				test := *config.test
+				test.Args = params.Arguments.Args
+				config.test = &test
+				config.program.Args = test.programParams().Args
+			}
+		}
+		if len(params.Arguments.Env) > 0 {
+			env := maps.Clone(config.program.Env)
+			if env == nil {
+				env = make(map[string]string)
+			}
+			maps.Copy(env, params.Arguments.Env)
+			config.program.Env = env
+		}
+		args, err := ds.launchArguments(config.program, config.mode)
+		if err != nil {
+			return nil, err
+		}
+		config.arguments = args
+	}
+	// The adapter goes through the configuration of the program on its own.
+	state := stateRunning
+	if config.stopsOnEntry() {
+		state = stateConfigured
+	}
+	undo := ds.status.begin(state)
+	msg, err := ds.client.RestartRequest(ctx, map[string]any{"arguments": config.arguments})
+	if err != nil {
+		undo()
 		return nil, err
 	}
-	if err := readAndValidateResponse(ds.client, "unable to restart debugger"); err != nil {
+	if err := validateResponse(msg, "unable to restart debugger"); err != nil {
+		undo()
 		return nil, err
 	}
+	ds.config = &config
+	if config.stopsOnEntry() {
+		ds.status.stopped("entry")
+	}
 
+	text, err := ds.reapplyBreakpoints(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("restarted debugging session, but %w", err)
+	}
 	return &mcp.CallToolResultFor[any]{
-		Content: []mcp.Content{&mcp.TextContent{Text: "Restarted debugging session"}},
+		Content: []mcp.Content{&mcp.TextContent{Text: "Restarted debugging session" + text}},
 	}, nil
 }
 
+// reapplyBreakpoints sets the breakpoints recorded for the session again,
+// as after a restart, and describes their new verification status.
+func (ds *debuggerSession) reapplyBreakpoints(ctx context.Context) (string, error) {
+	var text strings.Builder
+	for _, file := range slices.Sorted(maps.Keys(ds.breakpoints)) {
+		msg, err := ds.client.SetBreakpointsRequest(ctx, file, ds.breakpoints[file])
+		if err != nil {
+			return "", err
+		}
+		if err := validateResponse(msg, "unable to re-apply breakpoints in "+file); err != nil {
+			return "", err
+		}
+		response, ok := msg.(*dap.SetBreakpointsResponse)
+		if !ok {
+			return "", unexpectedResponse(msg, "unable to re-apply breakpoints in "+file)
+		}
+		for _, bp := range response.Body.Breakpoints {
+			text.WriteString("\n" + formatBreakpoint(bp))
+		}
+	}
+	if len(ds.functionBreakpoints) > 0 {
+		msg, err := ds.client.SetFunctionBreakpointsRequest(ctx, ds.functionBreakpoints)
+		if err != nil {
+			return "", err
+		}
+		if err := validateResponse(msg, "unable to re-apply function breakpoints"); err != nil {
+			return "", err
+		}
+		response, ok := msg.(*dap.SetFunctionBreakpointsResponse)
+		if !ok {
+			return "", unexpectedResponse(msg, "unable to re-apply function breakpoints")
+		}
+		for i, bp := range response.Body.Breakpoints {
+			text.WriteString("\n")
+			if i < len(ds.functionBreakpoints) {
+				text.WriteString(ds.functionBreakpoints[i] + ": ")
+			}
+			text.WriteString(formatBreakpoint(bp))
+		}
+	}
+	if len(ds.exceptionFilters) > 0 {
+		msg, err := ds.client.SetExceptionBreakpointsRequest(ctx, ds.exceptionFilters)
+		if err != nil {
+			return "", err
+		}
+		if err := validateResponse(msg, "unable to re-apply exception breakpoints"); err != nil {
+			return "", err
+		}
+		text.WriteString("\nEnabled exception filters: " + strings.Join(ds.exceptionFilters, ", "))
+	}
+	return text.String(), nil
+}
+
 // TerminateParams defines the parameters for terminating the debugger.
 type TerminateParams struct {
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
 }
 
 // terminateDebugger terminates the debuggee process.
 func (ds *debuggerSession) terminateDebugger(ctx context.Context, _ *mcp.ServerSession, _ *mcp.CallToolParamsFor[TerminateParams]) (*mcp.CallToolResultFor[any], error) {
 	if ds.client == nil {
-		return nil, fmt.Errorf("debugger not started")
+		return nil, errNotStarted
+	}
+	if err := ds.canExecute("terminate"); err != nil {
+		return nil, err
+	}
+	if err := ds.supports("terminate"); err != nil {
+		return nil, err
 	}
-	if err := ds.client.TerminateRequest(); err != nil {
+	if err := ds.require("terminate", liveStates...); err != nil {
 		return nil, err
 	}
-	if err := readAndValidateResponse(ds.client, "unable to terminate debugger"); err != nil {
+	msg, err := ds.client.TerminateRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateResponse(msg, "unable to terminate debugger"); err != nil {
 		return nil, err
 	}
 
@@ -899,60 +1786,60 @@ func (ds *debuggerSession) terminateDebugger(ctx context.Context, _ *mcp.ServerS
 
 // LoadedSourcesParams defines the parameters for getting loaded sources.
 type LoadedSourcesParams struct {
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
 }
 
 // getLoadedSources gets the list of all loaded source files.
 func (ds *debuggerSession) getLoadedSources(ctx context.Context, _ *mcp.ServerSession, _ *mcp.CallToolParamsFor[LoadedSourcesParams]) (*mcp.CallToolResultFor[any], error) {
 	if ds.client == nil {
-		return nil, fmt.Errorf("debugger not started")
+		return nil, errNotStarted
+	}
+	if err := ds.supports("loadedSources"); err != nil {
+		return nil, err
 	}
-	if err := ds.client.LoadedSourcesRequest(); err != nil {
+	if err := ds.require("loaded-sources", liveStates...); err != nil {
 		return nil, err
 	}
-	msg, err := ds.client.ReadMessage()
+	msg, err := ds.client.LoadedSourcesRequest(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	if resp, ok := msg.(dap.ResponseMessage); ok {
-		if !resp.GetResponse().Success {
-			return nil, fmt.Errorf("unable to get loaded sources: %s", resp.GetResponse().Message)
-		}
-		return &mcp.CallToolResultFor[any]{
-			Content: []mcp.Content{&mcp.TextContent{Text: "Retrieved loaded sources"}},
-		}, nil
+	if err := validateResponse(msg, "unable to get loaded sources"); err != nil {
+		return nil, err
 	}
-
-	return nil, fmt.Errorf("unexpected response type")
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: "Retrieved loaded sources"}},
+	}, nil
 }
 
 // ModulesParams defines the parameters for getting modules.
 type ModulesParams struct {
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
 }
 
 // getModules gets the list of all loaded modules.
 func (ds *debuggerSession) getModules(ctx context.Context, _ *mcp.ServerSession, _ *mcp.CallToolParamsFor[ModulesParams]) (*mcp.CallToolResultFor[any], error) {
 	if ds.client == nil {
-		return nil, fmt.Errorf("debugger not started")
+		return nil, errNotStarted
 	}
-	if err := ds.client.ModulesRequest(); err != nil {
+	if err := ds.supports("modules"); err != nil {
 		return nil, err
 	}
-	msg, err := ds.client.ReadMessage()
+	if err := ds.require("modules", liveStates...); err != nil {
+		return nil, err
+	}
+	msg, err := ds.client.ModulesRequest(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	if resp, ok := msg.(dap.ResponseMessage); ok {
-		if !resp.GetResponse().Success {
-			return nil, fmt.Errorf("unable to get modules: %s", resp.GetResponse().Message)
-		}
-		return &mcp.CallToolResultFor[any]{
-			Content: []mcp.Content{&mcp.TextContent{Text: "Retrieved modules"}},
-		}, nil
+	if err := validateResponse(msg, "unable to get modules"); err != nil {
+		return nil, err
 	}
-
-	return nil, fmt.Errorf("unexpected response type")
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: "Retrieved modules"}},
+	}, nil
 }
 
 // DisassembleParams defines the parameters for disassembling code.
@@ -960,51 +1847,203 @@ type DisassembleParams struct {
 	MemoryReference   string `json:"memoryReference" mcp:"memory reference to disassemble"`
 	InstructionOffset int    `json:"instructionOffset" mcp:"offset from the memory reference"`
 	InstructionCount  int    `json:"instructionCount" mcp:"number of instructions to disassemble"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
 }
 
 // disassembleCode disassembles code at a memory reference.
 func (ds *debuggerSession) disassembleCode(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[DisassembleParams]) (*mcp.CallToolResultFor[any], error) {
 	if ds.client == nil {
-		return nil, fmt.Errorf("debugger not started")
+		return nil, errNotStarted
+	}
+	if err := ds.supports("disassemble"); err != nil {
+		return nil, err
+	}
+	if err := ds.require("disassemble", stateStopped); err != nil {
+		return nil, err
+	}
+	msg, err := ds.client.DisassembleRequest(ctx, params.Arguments.MemoryReference, params.Arguments.InstructionOffset, params.Arguments.InstructionCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateResponse(msg, "unable to disassemble"); err != nil {
+		return nil, err
+	}
+	resp, ok := msg.(*dap.DisassembleResponse)
+	if !ok {
+		return nil, unexpectedResponse(msg, "unable to disassemble")
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Disassembly at %s:\n", params.Arguments.MemoryReference))
+	var lastSymbol, lastLocation string
+	for _, instruction := range resp.Body.Instructions {
+		// Symbols and source locations are only reported when they change.
+		if instruction.Symbol != "" && instruction.Symbol != lastSymbol {
+			result.WriteString(fmt.Sprintf("\n%s:\n", instruction.Symbol))
+			lastSymbol = instruction.Symbol
+		}
+		if instruction.Location != nil && instruction.Line > 0 {
+			if location := fmt.Sprintf("%s:%d", instruction.Location.Path, instruction.Line); location != lastLocation {
+				result.WriteString(fmt.Sprintf("  ; %s\n", location))
+				lastLocation = location
+			}
+		}
+		result.WriteString(fmt.Sprintf("  %s", instruction.Address))
+		if instruction.InstructionBytes != "" {
+			result.WriteString(fmt.Sprintf("  %-24s", instruction.InstructionBytes))
+		}
+		result.WriteString(fmt.Sprintf("  %s\n", instruction.Instruction))
+	}
+
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: result.String()}},
+	}, nil
+}
+
+// RegistersParams defines the parameters for reading registers.
+type RegistersParams struct {
+	FrameID int `json:"frameId" mcp:"stack frame ID"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
+}
+
+// getRegisters lists the CPU registers of a stack frame. DAP has no request for
+// registers; adapters of native debuggers such as lldb-dap and gdb expose them as
+// a scope of the frame instead, possibly split into groups of registers.
+func (ds *debuggerSession) getRegisters(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[RegistersParams]) (*mcp.CallToolResultFor[any], error) {
+	if ds.client == nil {
+		return nil, errNotStarted
 	}
-	if err := ds.client.DisassembleRequest(params.Arguments.MemoryReference, params.Arguments.InstructionOffset, params.Arguments.InstructionCount); err != nil {
+	if err := ds.require("registers", stateStopped); err != nil {
 		return nil, err
 	}
-	msg, err := ds.client.ReadMessage()
+	msg, err := ds.client.ScopesRequest(ctx, params.Arguments.FrameID)
 	if err != nil {
 		return nil, err
 	}
+	if err := validateResponse(msg, "unable to get registers"); err != nil {
+		return nil, err
+	}
+	resp, ok := msg.(*dap.ScopesResponse)
+	if !ok {
+		return nil, unexpectedResponse(msg, "unable to get registers")
+	}
+	var scope *dap.Scope
+	for i := range resp.Body.Scopes {
+		s := &resp.Body.Scopes[i]
+		if s.PresentationHint == "registers" || strings.Contains(strings.ToLower(s.Name), "register") {
+			scope = s
+			break
+		}
+	}
+	if scope == nil {
+		return nil, fmt.Errorf("the debug adapter does not expose registers for frame %d", params.Arguments.FrameID)
+	}
 
-	if resp, ok := msg.(dap.ResponseMessage); ok {
-		if !resp.GetResponse().Success {
-			return nil, fmt.Errorf("unable to disassemble: %s", resp.GetResponse().Message)
+	registers, err := ds.variables(ctx, scope.VariablesReference, "unable to get registers")
+	if err != nil {
+		return nil, err
+	}
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Registers of frame %d:\n", params.Arguments.FrameID))
+	for _, register := range registers {
+		if register.VariablesReference == 0 {
+			result.WriteString(fmt.Sprintf("  %s = %s\n", register.Name, register.Value))
+			continue
+		}
+		// A register group, or a register with fields: list its members.
+		result.WriteString(fmt.Sprintf("\n%s", register.Name))
+		if register.Value != "" {
+			result.WriteString(" = " + register.Value)
+		}
+		result.WriteString("\n")
+		members, err := ds.variables(ctx, register.VariablesReference, "unable to get registers")
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			result.WriteString(fmt.Sprintf("  %s = %s\n", member.Name, member.Value))
 		}
-		return &mcp.CallToolResultFor[any]{
-			Content: []mcp.Content{&mcp.TextContent{Text: "Disassembled code"}},
-		}, nil
 	}
 
-	return nil, fmt.Errorf("unexpected response type")
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: result.String()}},
+	}, nil
+}
+
+// variables returns the variables of the given container.
+func (ds *debuggerSession) variables(ctx context.Context, variablesReference int, errorPrefix string) ([]dap.Variable, error) {
+	msg, err := ds.client.VariablesRequest(ctx, variablesReference)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateResponse(msg, errorPrefix); err != nil {
+		return nil, err
+	}
+	resp, ok := msg.(*dap.VariablesResponse)
+	if !ok {
+		return nil, unexpectedResponse(msg, errorPrefix)
+	}
+	return resp.Body.Variables, nil
 }
 
 // AttachParams defines the parameters for attaching to a process.
 type AttachParams struct {
-	Mode      string `json:"mode" mcp:"attach mode (local or remote)"`
-	ProcessID int    `json:"processId" mcp:"process ID to attach to"`
+	Mode           string           `json:"mode" mcp:"attach mode: local to attach to processId, or remote to debug the process of a headless Delve server reached with connect-debugger"`
+	ProcessID      int              `json:"processId,omitempty" mcp:"process ID to attach to (local mode only)"`
+	SubstitutePath []substitutePath `json:"substitutePath,omitempty" mcp:"rules mapping local source directories to the directories the program was built in, applied to breakpoints and stack frames"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
 }
 
 // attachDebugger attaches the debugger to a running process.
+// In remote mode the session debugs the process of a headless Delve server
+// (dlv --headless --accept-multiclient) it connected to; disconnecting leaves
+// that process and the server running.
 func (ds *debuggerSession) attachDebugger(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[AttachParams]) (*mcp.CallToolResultFor[any], error) {
 	if ds.client == nil {
-		return nil, fmt.Errorf("debugger not started")
+		return nil, errNotStarted
 	}
-	if err := ds.client.AttachRequest(params.Arguments.Mode, params.Arguments.ProcessID); err != nil {
+	if err := ds.require("attach", stateAdapterStarted); err != nil {
 		return nil, err
 	}
-	if err := readAndValidateResponse(ds.client, "unable to attach to process"); err != nil {
+	args, err := ds.adapter.attachArguments(attachConfig{
+		Mode:           params.Arguments.Mode,
+		ProcessID:      params.Arguments.ProcessID,
+		SubstitutePath: params.Arguments.SubstitutePath,
+	})
+	if err != nil {
 		return nil, err
 	}
+	if ds.adapter.answersAfterConfiguration {
+		wait, err := ds.client.StartAttachRequest(args)
+		if err != nil {
+			return nil, err
+		}
+		ds.deferStart(wait, "unable to attach to process")
+	} else {
+		msg, err := ds.client.AttachRequest(ctx, args)
+		if err != nil {
+			return nil, err
+		}
+		if err := validateResponse(msg, "unable to attach to process"); err != nil {
+			return nil, err
+		}
+	}
+	ds.config = &sessionConfig{request: "attach", arguments: args}
+	ds.status.set(stateLaunched)
+	if params.Arguments.Mode != "remote" {
+		ds.status.setPID(params.Arguments.ProcessID)
+	}
 
+	if params.Arguments.Mode == "remote" {
+		ds.remote = true
+		return &mcp.CallToolResultFor[any]{
+			Content: []mcp.Content{&mcp.TextContent{Text: "Attached to the process of the remote Delve server"}},
+		}, nil
+	}
 	return &mcp.CallToolResultFor[any]{
 		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Attached to process %d", params.Arguments.ProcessID)}},
 	}, nil
@@ -1013,55 +2052,196 @@ func (ds *debuggerSession) attachDebugger(ctx context.Context, _ *mcp.ServerSess
 // DisconnectParams defines the parameters for disconnecting from the debugger.
 type DisconnectParams struct {
 	TerminateDebuggee bool `json:"terminateDebuggee" mcp:"whether to terminate the debuggee (default: false)"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
 }
 
 // disconnect disconnects from the debugger.
 func (ds *debuggerSession) disconnect(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[DisconnectParams]) (*mcp.CallToolResultFor[any], error) {
 	if ds.client == nil {
-		return nil, fmt.Errorf("debugger not started")
+		return nil, errNotStarted
 	}
-	if err := ds.client.DisconnectRequest(params.Arguments.TerminateDebuggee); err != nil {
+	msg, err := ds.client.DisconnectRequest(ctx, params.Arguments.TerminateDebuggee)
+	if err != nil {
 		return nil, err
 	}
-	if err := readAndValidateResponse(ds.client, "unable to disconnect"); err != nil {
+	if err := validateResponse(msg, "unable to disconnect"); err != nil {
 		return nil, err
 	}
 
-	// Clean up client connection
-	ds.client.Close()
-	ds.client = nil
+	// Nothing is left to debug: stop the adapter if it was started here,
+	// rather than waiting for stop-debugger.
+	if err := ds.release(); err != nil {
+		return nil, err
+	}
 
+	text := "Disconnected from debugger"
+	if ds.remote && !params.Arguments.TerminateDebuggee {
+		text += "; the remote process keeps running"
+	}
 	return &mcp.CallToolResultFor[any]{
-		Content: []mcp.Content{&mcp.TextContent{Text: "Disconnected from debugger"}},
+		Content: []mcp.Content{&mcp.TextContent{Text: text}},
 	}, nil
 }
 
 // ExceptionInfoParams defines the parameters for getting exception info.
 type ExceptionInfoParams struct {
 	ThreadID int `json:"threadId" mcp:"thread ID to get exception info for"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
 }
 
 // getExceptionInfo gets information about an exception in a thread.
 func (ds *debuggerSession) getExceptionInfo(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[ExceptionInfoParams]) (*mcp.CallToolResultFor[any], error) {
 	if ds.client == nil {
-		return nil, fmt.Errorf("debugger not started")
+		return nil, errNotStarted
+	}
+	if err := ds.supports("exceptionInfo"); err != nil {
+		return nil, err
 	}
-	if err := ds.client.ExceptionInfoRequest(params.Arguments.ThreadID); err != nil {
+	if err := ds.require("exception-info", stateStopped); err != nil {
 		return nil, err
 	}
-	msg, err := ds.client.ReadMessage()
+	msg, err := ds.client.ExceptionInfoRequest(ctx, params.Arguments.ThreadID)
 	if err != nil {
 		return nil, err
 	}
 
-	if resp, ok := msg.(dap.ResponseMessage); ok {
-		if !resp.GetResponse().Success {
-			return nil, fmt.Errorf("unable to get exception info: %s", resp.GetResponse().Message)
+	if err := validateResponse(msg, "unable to get exception info"); err != nil {
+		return nil, err
+	}
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: "Retrieved exception info"}},
+	}, nil
+}
+
+// EventsParams defines the parameters for reading the event journal.
+type EventsParams struct {
+	Since int      `json:"since,omitempty" mcp:"only return events with a sequence number greater than this cursor (default: 0)"`
+	Types []string `json:"types,omitempty" mcp:"only return events of these types, e.g. stopped, output, thread (default: all)"`
+	Limit int      `json:"limit,omitempty" mcp:"maximum number of events to return (default: 100)"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
+}
+
+// listEvents returns the events recorded since the given cursor.
+// Each event is listed with its sequence number, the time it was received,
+// its type and its JSON body. The result ends with the cursor to use for the next call.
+func (ds *debuggerSession) listEvents(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[EventsParams]) (*mcp.CallToolResultFor[any], error) {
+	if ds.events == nil {
+		return nil, errNotStarted
+	}
+
+	limit := params.Arguments.Limit
+	if limit == 0 {
+		limit = 100
+	}
+	entries, next, dropped := ds.events.since(params.Arguments.Since, params.Arguments.Types, limit)
+
+	var result strings.Builder
+	if dropped > 0 {
+		result.WriteString(fmt.Sprintf("%d older events were discarded before they could be read.\n", dropped))
+	}
+	if len(entries) == 0 {
+		result.WriteString("No new events.\n")
+	}
+	for _, entry := range entries {
+		result.WriteString(fmt.Sprintf("#%d %s %s", entry.Seq, entry.Time.Format("15:04:05.000"), entry.Type()))
+		if body := entry.Body(); len(body) > 0 {
+			result.WriteString(" ")
+			result.Write(body)
+		}
+		result.WriteString("\n")
+	}
+	result.WriteString(fmt.Sprintf("\nNext cursor: %d", next))
+
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: result.String()}},
+	}, nil
+}
+
+// ProgramOutputParams defines the parameters for reading program output.
+type ProgramOutputParams struct {
+	Since      int      `json:"since,omitempty" mcp:"only return output after this cursor (default: 0)"`
+	Tail       int      `json:"tail,omitempty" mcp:"only return the last N lines of output"`
+	Grep       string   `json:"grep,omitempty" mcp:"regular expression; only lines matching it are returned"`
+	Categories []string `json:"categories,omitempty" mcp:"output categories to include: stdout, stderr, console, important, adapter (default: all but adapter)"`
+
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
+}
+
+// programOutput returns the output captured for the current debugger session.
+// Every line is prefixed with its category and, when the adapter reports it,
+// followed by the source location that produced it. The result ends with the
+// cursor to pass as since on the next call.
+func (ds *debuggerSession) programOutput(ctx context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[ProgramOutputParams]) (*mcp.CallToolResultFor[any], error) {
+	if ds.output == nil {
+		return nil, errNotStarted
+	}
+
+	var re *regexp.Regexp
+	if params.Arguments.Grep != "" {
+		var err error
+		re, err = regexp.Compile(params.Arguments.Grep)
+		if err != nil {
+			return nil, fmt.Errorf("invalid grep pattern: %w", err)
+		}
+	}
+	categories := params.Arguments.Categories
+	entries, next := ds.output.since(params.Arguments.Since, func(e outputEntry) bool {
+		if len(categories) == 0 {
+			return e.Category != "adapter"
+		}
+		return slices.Contains(categories, e.Category)
+	})
+
+	var lines []string
+	for _, entry := range entries {
+		location := ""
+		if entry.Source != "" {
+			location = fmt.Sprintf(" (at %s:%d)", entry.Source, entry.Line)
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(entry.Output, "\n"), "\n") {
+			if re != nil && !re.MatchString(line) {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("[%s] %s%s", entry.Category, line, location))
 		}
-		return &mcp.CallToolResultFor[any]{
-			Content: []mcp.Content{&mcp.TextContent{Text: "Retrieved exception info"}},
-		}, nil
 	}
+	if tail := params.Arguments.Tail; tail > 0 && len(lines) > tail {
+		lines = lines[len(lines)-tail:]
+	}
+
+	var result strings.Builder
+	if len(lines) == 0 {
+		result.WriteString("No new output.\n")
+	}
+	for _, line := range lines {
+		result.WriteString(line)
+		result.WriteString("\n")
+	}
+	result.WriteString(fmt.Sprintf("\nNext cursor: %d", next))
+
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: result.String()}},
+	}, nil
+}
 
-	return nil, fmt.Errorf("unexpected response type")
+// CapabilitiesParams defines the parameters for getting the adapter capabilities.
+type CapabilitiesParams struct {
+	SessionID string `json:"sessionId,omitempty" mcp:"ID of the debugger session to use (default: the most recently used session)"`
+}
+
+// getCapabilities returns the capabilities negotiated with the debug adapter, as JSON.
+func (ds *debuggerSession) getCapabilities(ctx context.Context, _ *mcp.ServerSession, _ *mcp.CallToolParamsFor[CapabilitiesParams]) (*mcp.CallToolResultFor[any], error) {
+	if ds.capabilities == nil {
+		return nil, errNotStarted
+	}
+	capabilitiesJSON, err := json.MarshalIndent(ds.capabilities, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal capabilities: %w", err)
+	}
+	return &mcp.CallToolResultFor[any]{
+		Content: []mcp.Content{&mcp.TextContent{Text: string(capabilitiesJSON)}},
+	}, nil
 }
@@ -1,16 +1,23 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/go-dap"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
@@ -852,3 +859,626 @@ func TestNextStep(t *testing.T) {
 	// Stop debugger
 	ts.stopDebugger(t)
 }
+
+func TestListenAddress(t *testing.T) {
+	ds := &debuggerSession{}
+
+	network, addr, err := ds.listenAddress(StartDebuggerParams{Port: "9095"})
+	if err != nil || network != "tcp" || addr != "127.0.0.1:9095" {
+		t.Errorf("expected loopback tcp address by default, got %s %s (%v)", network, addr, err)
+	}
+
+	t.Setenv("MCP_DAP_ALLOW_REMOTE_LISTEN", "")
+	if _, _, err := ds.listenAddress(StartDebuggerParams{Port: "9095", Host: "0.0.0.0"}); err == nil {
+		t.Error("expected listening on all interfaces to be refused without opt-in")
+	}
+	t.Setenv("MCP_DAP_ALLOW_REMOTE_LISTEN", "1")
+	if _, addr, err := ds.listenAddress(StartDebuggerParams{Port: "9095", Host: "0.0.0.0"}); err != nil || addr != "0.0.0.0:9095" {
+		t.Errorf("expected opt-in to allow listening on all interfaces, got %s (%v)", addr, err)
+	}
+
+	network, addr, err = ds.listenAddress(StartDebuggerParams{Listen: "unix"})
+	if err != nil || network != "unix" {
+		t.Fatalf("expected unix socket address, got %s %s (%v)", network, addr, err)
+	}
+	defer os.RemoveAll(ds.socketDir)
+	info, err := os.Stat(filepath.Dir(addr))
+	if err != nil {
+		t.Fatalf("socket directory: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o700 {
+		t.Errorf("expected private socket directory, got mode %o", perm)
+	}
+}
+
+func TestUnsupportedCapability(t *testing.T) {
+	client, _ := newFakeAdapter(t)
+	ds := &debuggerSession{client: client, capabilities: &dap.Capabilities{SupportsSetVariable: true}}
+
+	_, err := ds.disassembleCode(context.Background(), nil, &mcp.CallToolParamsFor[DisassembleParams]{
+		Arguments: DisassembleParams{MemoryReference: "0x1000", InstructionCount: 10},
+	})
+	if !errors.Is(err, errNotSupported) {
+		t.Fatalf("expected disassemble to be refused as not supported, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "supportsDisassembleRequest") {
+		t.Errorf("expected error to name the missing capability, got %v", err)
+	}
+	if err := ds.supports("setVariable"); err != nil {
+		t.Errorf("expected setVariable to be supported, got %v", err)
+	}
+}
+
+func TestSetExceptionBreakpoints(t *testing.T) {
+	client, adapter := newFakeAdapter(t)
+	ds := &debuggerSession{client: client, status: sessionStatus{state: stateLaunched}, capabilities: &dap.Capabilities{
+		ExceptionBreakpointFilters: []dap.ExceptionBreakpointsFilter{{Filter: "raised"}, {Filter: "uncaught"}},
+	}}
+
+	_, err := ds.setExceptionBreakpoints(context.Background(), nil, &mcp.CallToolParamsFor[SetExceptionBreakpointsParams]{
+		Arguments: SetExceptionBreakpointsParams{Filters: []string{"panic"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "raised, uncaught") {
+		t.Fatalf("expected unknown filter to be refused with the supported ones, got %v", err)
+	}
+
+	go func() {
+		req := adapter.readRequest(t)
+		if req == nil {
+			return
+		}
+		if filters := req.(*dap.SetExceptionBreakpointsRequest).Arguments.Filters; !slices.Equal(filters, []string{"uncaught"}) {
+			t.Errorf("unexpected filters %v", filters)
+		}
+		adapter.write(t, &dap.SetExceptionBreakpointsResponse{Response: newResponse(req)})
+	}()
+	res, err := ds.setExceptionBreakpoints(context.Background(), nil, &mcp.CallToolParamsFor[SetExceptionBreakpointsParams]{
+		Arguments: SetExceptionBreakpointsParams{Filters: []string{"uncaught"}},
+	})
+	if err != nil {
+		t.Fatalf("setExceptionBreakpoints: %v", err)
+	}
+	if text := res.Content[0].(*mcp.TextContent).Text; !strings.Contains(text, "uncaught") {
+		t.Errorf("unexpected result: %s", text)
+	}
+}
+
+func TestDisassembleAndRegisters(t *testing.T) {
+	client, adapter := newFakeAdapter(t)
+	ds := &debuggerSession{client: client, status: sessionStatus{state: stateStopped}, capabilities: &dap.Capabilities{SupportsDisassembleRequest: true}}
+
+	go func() {
+		req := adapter.readRequest(t)
+		if req == nil {
+			return
+		}
+		adapter.write(t, &dap.DisassembleResponse{Response: newResponse(req), Body: dap.DisassembleResponseBody{
+			Instructions: []dap.DisassembledInstruction{
+				{Address: "0x401000", InstructionBytes: "55", Instruction: "push rbp", Symbol: "main", Location: &dap.Source{Path: "main.c"}, Line: 3},
+				{Address: "0x401001", InstructionBytes: "48 89 e5", Instruction: "mov rbp, rsp", Symbol: "main"},
+			},
+		}})
+	}()
+	res, err := ds.disassembleCode(context.Background(), nil, &mcp.CallToolParamsFor[DisassembleParams]{
+		Arguments: DisassembleParams{MemoryReference: "0x401000", InstructionCount: 2},
+	})
+	if err != nil {
+		t.Fatalf("disassemble: %v", err)
+	}
+	text := res.Content[0].(*mcp.TextContent).Text
+	for _, want := range []string{"main:", "; main.c:3", "0x401000", "push rbp", "mov rbp, rsp"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("disassembly is missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Count(text, "main:") != 1 {
+		t.Errorf("expected the symbol to be reported once:\n%s", text)
+	}
+
+	go func() {
+		req := adapter.readRequest(t)
+		if req == nil {
+			return
+		}
+		adapter.write(t, &dap.ScopesResponse{Response: newResponse(req), Body: dap.ScopesResponseBody{
+			Scopes: []dap.Scope{{Name: "Locals", VariablesReference: 1}, {Name: "Registers", VariablesReference: 2}},
+		}})
+		for _, vars := range [][]dap.Variable{
+			{{Name: "General Purpose Registers", VariablesReference: 3}},
+			{{Name: "rip", Value: "0x401000"}, {Name: "rsp", Value: "0x7ffc0000"}},
+		} {
+			req := adapter.readRequest(t)
+			if req == nil {
+				return
+			}
+			adapter.write(t, &dap.VariablesResponse{Response: newResponse(req), Body: dap.VariablesResponseBody{Variables: vars}})
+		}
+	}()
+	res, err = ds.getRegisters(context.Background(), nil, &mcp.CallToolParamsFor[RegistersParams]{Arguments: RegistersParams{FrameID: 1000}})
+	if err != nil {
+		t.Fatalf("registers: %v", err)
+	}
+	text = res.Content[0].(*mcp.TextContent).Text
+	for _, want := range []string{"General Purpose Registers", "rip = 0x401000", "rsp = 0x7ffc0000"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("registers are missing %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestConnectDebugger(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	disconnected := make(chan bool, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		adapter := &fakeAdapter{conn: conn, reader: bufio.NewReader(conn), seq: 1}
+		for {
+			switch req := adapter.readRequest(t).(type) {
+			case *dap.InitializeRequest:
+				adapter.write(t, &dap.InitializeResponse{Response: newResponse(req)})
+			case *dap.DisconnectRequest:
+				disconnected <- req.Arguments != nil && req.Arguments.TerminateDebuggee
+				adapter.write(t, &dap.DisconnectResponse{Response: newResponse(req)})
+				return
+			default:
+				return
+			}
+		}
+	}()
+
+	ds := &debuggerSession{}
+	if _, err := ds.connectDebugger(context.Background(), nil, &mcp.CallToolParamsFor[ConnectDebuggerParams]{
+		Arguments: ConnectDebuggerParams{Address: l.Addr().String()},
+	}); err != nil {
+		t.Fatalf("connectDebugger: %v", err)
+	}
+	if ds.ownsAdapter || ds.cmd != nil || ds.capabilities == nil {
+		t.Fatalf("unexpected session after connecting: owns=%v cmd=%v capabilities=%v", ds.ownsAdapter, ds.cmd, ds.capabilities)
+	}
+
+	res, err := ds.stopDebugger(context.Background(), nil, &mcp.CallToolParamsFor[StopDebuggerParams]{})
+	if err != nil {
+		t.Fatalf("stopDebugger: %v", err)
+	}
+	if text := res.Content[0].(*mcp.TextContent).Text; !strings.Contains(text, "keeps running") {
+		t.Errorf("unexpected stop result: %s", text)
+	}
+	select {
+	case terminate := <-disconnected:
+		if terminate {
+			t.Error("stop-debugger asked the adapter to terminate a debuggee it does not own")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stop-debugger did not disconnect from the adapter")
+	}
+}
+
+func TestConnectDebuggerInitializeFailure(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	closed := make(chan struct{})
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		adapter := &fakeAdapter{conn: conn, reader: bufio.NewReader(conn), seq: 1}
+		req := adapter.readRequest(t)
+		if req == nil {
+			return
+		}
+		adapter.write(t, &dap.ErrorResponse{
+			Response: dap.Response{
+				ProtocolMessage: dap.ProtocolMessage{Type: "response"},
+				Command:         req.GetRequest().Command,
+				RequestSeq:      req.GetRequest().Seq,
+				Message:         "unsupported client",
+			},
+		})
+		// The server must hang up once the handshake failed.
+		if _, err := dap.ReadProtocolMessage(adapter.reader); err != nil {
+			close(closed)
+		}
+	}()
+
+	ds := &debuggerSession{}
+	_, err = ds.connectDebugger(context.Background(), nil, &mcp.CallToolParamsFor[ConnectDebuggerParams]{
+		Arguments: ConnectDebuggerParams{Address: l.Addr().String(), Trace: filepath.Join(t.TempDir(), "trace.jsonl")},
+	})
+	if err == nil || !strings.Contains(err.Error(), "unsupported client") {
+		t.Fatalf("expected connectDebugger to report the rejected handshake, got %v", err)
+	}
+	if ds.client != nil || ds.tracer != nil {
+		t.Errorf("connection or trace left open: client=%v tracer=%v", ds.client, ds.tracer)
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("the connection to the adapter was not closed")
+	}
+}
+
+func TestDialAddress(t *testing.T) {
+	for _, tt := range []struct{ address, network, addr string }{
+		{"localhost:2345", "tcp", "localhost:2345"},
+		{"unix:/tmp/dlv.sock", "unix", "/tmp/dlv.sock"},
+		{"/tmp/dlv.sock", "unix", "/tmp/dlv.sock"},
+	} {
+		if network, addr := dialAddress(tt.address); network != tt.network || addr != tt.addr {
+			t.Errorf("dialAddress(%q) = %s %s, want %s %s", tt.address, network, addr, tt.network, tt.addr)
+		}
+	}
+}
+
+func TestDebugTest(t *testing.T) {
+	client, adapter := newFakeAdapter(t)
+	ds := &debuggerSession{client: client, adapter: delveAdapter, status: sessionStatus{state: stateAdapterStarted}}
+
+	go func() {
+		req := adapter.readRequest(t)
+		if req == nil {
+			return
+		}
+		var args map[string]any
+		if err := json.Unmarshal(req.(*dap.LaunchRequest).Arguments, &args); err != nil {
+			t.Errorf("invalid launch arguments: %v", err)
+		}
+		got, _ := json.Marshal(args)
+		want := `{"args":["-test.run","^TestParse$","-test.count","1","-test.v"],"buildFlags":"-tags=integration,linux -race","mode":"test","program":"./internal/parser","request":"launch","stopOnEntry":true}`
+		if string(got) != want {
+			t.Errorf("got launch arguments %s, want %s", got, want)
+		}
+		adapter.write(t, &dap.LaunchResponse{Response: newResponse(req)})
+
+		// Restarting with new arguments keeps the tests to run.
+		req = adapter.readRequest(t)
+		if req == nil {
+			return
+		}
+		var restart struct {
+			Arguments map[string]any `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.(*dap.RestartRequest).Arguments, &restart); err != nil {
+			t.Errorf("invalid restart arguments: %v", err)
+		}
+		got, _ = json.Marshal(restart.Arguments["args"])
+		if want := `["-test.run","^TestParse$","-test.count","1","-test.short"]`; string(got) != want {
+			t.Errorf("got restart args %s, want %s", got, want)
+		}
+		adapter.write(t, &dap.RestartResponse{Response: newResponse(req)})
+	}()
+	res, err := ds.debugTest(context.Background(), nil, &mcp.CallToolParamsFor[DebugTestParams]{Arguments: DebugTestParams{
+		Package:    "./internal/parser",
+		Run:        "^TestParse$",
+		Count:      1,
+		Tags:       []string{"integration", "linux"},
+		Args:       []string{"-test.v"},
+		BuildFlags: "-race",
+	}})
+	if err != nil {
+		t.Fatalf("debugTest: %v", err)
+	}
+	if text := res.Content[0].(*mcp.TextContent).Text; text != "Started debugging tests in ./internal/parser matching ^TestParse$" {
+		t.Errorf("unexpected result: %s", text)
+	}
+	if _, err := ds.restartDebugger(context.Background(), nil, &mcp.CallToolParamsFor[RestartParams]{Arguments: RestartParams{Args: []string{"-test.short"}}}); err != nil {
+		t.Fatalf("restartDebugger: %v", err)
+	}
+
+	ds.adapter = debugpyAdapter
+	ds.status.reset(stateAdapterStarted)
+	if _, err := ds.debugTest(context.Background(), nil, &mcp.CallToolParamsFor[DebugTestParams]{Arguments: DebugTestParams{Package: "."}}); err == nil || !strings.Contains(err.Error(), "needs the dlv adapter") {
+		t.Errorf("expected debug-test to be refused by debugpy, got %v", err)
+	}
+}
+
+func TestLaunchAnsweredAfterConfiguration(t *testing.T) {
+	for _, test := range []struct {
+		adapter *debugAdapter
+		path    string
+		fail    bool
+	}{
+		{debugpyAdapter, "app.py", false},
+		{debugpyAdapter, "app.py", true},
+		{lldbAdapter, "./app", false},
+		{gdbAdapter, "./app", false},
+		{gdbAdapter, "./app", true},
+	} {
+		fail := test.fail
+		client, adapter := newFakeAdapter(t)
+		ds := &debuggerSession{client: client, adapter: test.adapter, status: sessionStatus{state: stateAdapterStarted}}
+		client.Subscribe(ds.status.recordEvent)
+
+		// Like debugpy, lldb-dap and GDB, the adapter only answers launch once configured.
+		go func() {
+			var launch dap.RequestMessage
+			for {
+				msg, err := dap.ReadProtocolMessage(adapter.reader)
+				if err != nil {
+					return
+				}
+				switch req := msg.(type) {
+				case *dap.LaunchRequest:
+					launch = req
+					adapter.write(t, &dap.InitializedEvent{Event: newEvent("initialized")})
+				case *dap.SetBreakpointsRequest:
+					if launch == nil {
+						t.Errorf("setBreakpoints sent before launch")
+					}
+					adapter.write(t, &dap.SetBreakpointsResponse{Response: newResponse(req)})
+				case *dap.ConfigurationDoneRequest:
+					if launch == nil {
+						t.Errorf("configurationDone sent before launch")
+						return
+					}
+					adapter.write(t, &dap.ConfigurationDoneResponse{Response: newResponse(req)})
+					if fail {
+						resp := &dap.ErrorResponse{Response: newResponse(launch)}
+						resp.Success = false
+						resp.Message = "No such file"
+						adapter.write(t, resp)
+						continue
+					}
+					adapter.write(t, &dap.LaunchResponse{Response: newResponse(launch)})
+					adapter.write(t, &dap.StoppedEvent{Event: newEvent("stopped"), Body: dap.StoppedEventBody{Reason: "entry", ThreadId: 1}})
+				default:
+					t.Errorf("unexpected request %#v", req)
+					return
+				}
+			}
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := ds.debugProgram(ctx, nil, &mcp.CallToolParamsFor[DebugProgramParams]{Arguments: DebugProgramParams{Path: test.path}}); err != nil {
+			t.Fatalf("%s debugProgram: %v", test.adapter.name, err)
+		}
+		if got := ds.status.current(); got != stateLaunched {
+			t.Fatalf("got state %s after launch, want launched", got)
+		}
+		// Running the program would leave the launch response uncollected.
+		if _, err := ds.continueExecution(ctx, nil, &mcp.CallToolParamsFor[ContinueParams]{}); !errors.Is(err, errInvalidState) || !strings.Contains(err.Error(), "call configuration-done first") {
+			t.Errorf("expected continue to be refused before configuration-done, got %v", err)
+		}
+		if _, err := ds.restartDebugger(ctx, nil, &mcp.CallToolParamsFor[RestartParams]{}); !errors.Is(err, errInvalidState) || !strings.Contains(err.Error(), "call configuration-done first") {
+			t.Errorf("expected restart to be refused before configuration-done, got %v", err)
+		}
+		if _, err := ds.setBreakpoints(ctx, nil, &mcp.CallToolParamsFor[SetBreakpointsParams]{Arguments: SetBreakpointsParams{File: "app.c", Lines: []int{3}}}); err != nil {
+			t.Fatalf("setBreakpoints: %v", err)
+		}
+		res, err := ds.configurationDone(ctx, nil, &mcp.CallToolParamsFor[ConfigurationDoneParams]{})
+		if fail {
+			if err == nil || !strings.Contains(err.Error(), "No such file") {
+				t.Errorf("expected configuration-done to report the failed %s launch, got %v", test.adapter.name, err)
+			}
+			if got := ds.status.current(); got != stateAdapterStarted || ds.config != nil {
+				t.Errorf("got state %s and config %v after a failed launch, want adapter-started and none", got, ds.config)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s configurationDone: %v", test.adapter.name, err)
+		}
+		if text := res.Content[0].(*mcp.TextContent).Text; !strings.Contains(text, "stopped on entry") {
+			t.Errorf("unexpected configuration-done result: %s", text)
+		}
+		if got := ds.status.current(); got != stateStopped {
+			t.Errorf("got state %s after configuration-done, want stopped", got)
+		}
+	}
+}
+
+func TestDebugCore(t *testing.T) {
+	client, adapter := newFakeAdapter(t)
+	ds := &debuggerSession{client: client, adapter: delveAdapter, status: sessionStatus{state: stateAdapterStarted}}
+
+	go func() {
+		req := adapter.readRequest(t)
+		if req == nil {
+			return
+		}
+		var args map[string]any
+		if err := json.Unmarshal(req.(*dap.LaunchRequest).Arguments, &args); err != nil {
+			t.Errorf("invalid launch arguments: %v", err)
+		}
+		if args["mode"] != "core" || args["program"] != "./app" || args["coreFilePath"] != "core.1234" {
+			t.Errorf("unexpected launch arguments %v", args)
+		}
+		adapter.write(t, &dap.LaunchResponse{Response: newResponse(req)})
+		req = adapter.readRequest(t)
+		if req == nil {
+			return
+		}
+		adapter.write(t, &dap.ConfigurationDoneResponse{Response: newResponse(req)})
+	}()
+	if _, err := ds.debugCore(context.Background(), nil, &mcp.CallToolParamsFor[DebugCoreParams]{Arguments: DebugCoreParams{Path: "./app", CoreFile: "core.1234"}}); err != nil {
+		t.Fatalf("debugCore: %v", err)
+	}
+
+	_, err := ds.continueExecution(context.Background(), nil, &mcp.CallToolParamsFor[ContinueParams]{})
+	if !errors.Is(err, errReadOnly) || !strings.Contains(err.Error(), "core.1234") {
+		t.Errorf("expected continue to be refused in a core session, got %v", err)
+	}
+	if _, err := ds.setBreakpoints(context.Background(), nil, &mcp.CallToolParamsFor[SetBreakpointsParams]{}); !errors.Is(err, errReadOnly) {
+		t.Errorf("expected set-breakpoints to be refused in a core session, got %v", err)
+	}
+	if _, err := ds.terminateDebugger(context.Background(), nil, &mcp.CallToolParamsFor[TerminateParams]{}); !errors.Is(err, errReadOnly) {
+		t.Errorf("expected terminate to be refused in a core session, got %v", err)
+	}
+
+	go func() {
+		req := adapter.readRequest(t)
+		if req == nil {
+			return
+		}
+		adapter.write(t, &dap.ThreadsResponse{Response: newResponse(req), Body: dap.ThreadsResponseBody{Threads: []dap.Thread{{Id: 1, Name: "main"}}}})
+	}()
+	if _, err := ds.listThreads(context.Background(), nil, &mcp.CallToolParamsFor[ThreadsParams]{}); err != nil {
+		t.Errorf("threads: %v", err)
+	}
+}
+
+func TestRestartReplaysConfiguration(t *testing.T) {
+	client, adapter := newFakeAdapter(t)
+	ds := &debuggerSession{client: client, adapter: delveAdapter, status: sessionStatus{state: stateAdapterStarted}}
+
+	restarts := make(chan map[string]any, 1)
+	go func() {
+		// Serve requests until the client is closed at the end of the test.
+		for {
+			msg, err := dap.ReadProtocolMessage(adapter.reader)
+			if err != nil {
+				return
+			}
+			switch req := msg.(type) {
+			case *dap.LaunchRequest:
+				adapter.write(t, &dap.LaunchResponse{Response: newResponse(req)})
+			case *dap.RestartRequest:
+				var args struct {
+					Arguments map[string]any `json:"arguments"`
+				}
+				if err := json.Unmarshal(req.Arguments, &args); err != nil {
+					t.Errorf("invalid restart arguments: %v", err)
+				}
+				restarts <- args.Arguments
+				adapter.write(t, &dap.RestartResponse{Response: newResponse(req)})
+			case *dap.SetBreakpointsRequest:
+				resp := &dap.SetBreakpointsResponse{Response: newResponse(req)}
+				for i, bp := range req.Arguments.Breakpoints {
+					resp.Body.Breakpoints = append(resp.Body.Breakpoints, dap.Breakpoint{Id: i + 1, Verified: true, Line: bp.Line, Source: &req.Arguments.Source})
+				}
+				adapter.write(t, resp)
+			case *dap.SetFunctionBreakpointsRequest:
+				resp := &dap.SetFunctionBreakpointsResponse{Response: newResponse(req)}
+				for range req.Arguments.Breakpoints {
+					resp.Body.Breakpoints = append(resp.Body.Breakpoints, dap.Breakpoint{Verified: false, Message: "could not find function"})
+				}
+				adapter.write(t, resp)
+			default:
+				t.Errorf("unexpected request %#v", req)
+				return
+			}
+		}
+	}()
+
+	ctx := context.Background()
+	if _, err := ds.restartDebugger(ctx, nil, &mcp.CallToolParamsFor[RestartParams]{}); err == nil {
+		t.Error("expected restart to fail before a program is launched")
+	}
+	if _, err := ds.debugProgram(ctx, nil, &mcp.CallToolParamsFor[DebugProgramParams]{Arguments: DebugProgramParams{
+		Path: "./app",
+		Args: []string{"-v"},
+		Env:  map[string]string{"A": "1"},
+	}}); err != nil {
+		t.Fatalf("debugProgram: %v", err)
+	}
+	if _, err := ds.setBreakpoints(ctx, nil, &mcp.CallToolParamsFor[SetBreakpointsParams]{Arguments: SetBreakpointsParams{File: "/src/main.go", Lines: []int{10, 20}}}); err != nil {
+		t.Fatalf("setBreakpoints: %v", err)
+	}
+	if _, err := ds.setFunctionBreakpoints(ctx, nil, &mcp.CallToolParamsFor[SetFunctionBreakpointsParams]{Arguments: SetFunctionBreakpointsParams{Functions: []string{"main.gone"}}}); err != nil {
+		t.Fatalf("setFunctionBreakpoints: %v", err)
+	}
+
+	// Delve would restart the program with the environment of the first launch.
+	_, err := ds.restartDebugger(ctx, nil, &mcp.CallToolParamsFor[RestartParams]{Arguments: RestartParams{
+		Args: []string{"-q"},
+		Env:  map[string]string{"B": "2"},
+	}})
+	if !errors.Is(err, errNotSupported) || !strings.Contains(err.Error(), "env") {
+		t.Errorf("expected Delve to refuse an env override, got %v", err)
+	}
+	res, err := ds.restartDebugger(ctx, nil, &mcp.CallToolParamsFor[RestartParams]{Arguments: RestartParams{Args: []string{"-q"}}})
+	if err != nil {
+		t.Fatalf("restartDebugger: %v", err)
+	}
+	args := <-restarts
+	got, _ := json.Marshal(args)
+	want := `{"args":["-q"],"env":{"A":"1"},"mode":"debug","program":"./app","request":"launch","stopOnEntry":true}`
+	if string(got) != want {
+		t.Errorf("got restart arguments %s, want %s", got, want)
+	}
+	text := res.Content[0].(*mcp.TextContent).Text
+	for _, want := range []string{"created at /src/main.go:10", "created at /src/main.go:20", "main.gone: Breakpoint unable to be created"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("restart result %q does not mention %q", text, want)
+		}
+	}
+
+	// Without overrides, the previous configuration is replayed as is.
+	if _, err := ds.restartDebugger(ctx, nil, &mcp.CallToolParamsFor[RestartParams]{}); err != nil {
+		t.Fatalf("restartDebugger: %v", err)
+	}
+	if got, _ := json.Marshal(<-restarts); string(got) != want {
+		t.Errorf("got restart arguments %s, want %s", got, want)
+	}
+}
+
+func TestRestartEnv(t *testing.T) {
+	client, adapter := newFakeAdapter(t)
+	ds := &debuggerSession{client: client, adapter: lldbAdapter, status: sessionStatus{state: stateAdapterStarted}}
+	client.Subscribe(ds.status.recordEvent)
+
+	restarts := make(chan map[string]any, 1)
+	go func() {
+		var launch dap.RequestMessage
+		for {
+			msg, err := dap.ReadProtocolMessage(adapter.reader)
+			if err != nil {
+				return
+			}
+			switch req := msg.(type) {
+			case *dap.LaunchRequest:
+				launch = req
+			case *dap.ConfigurationDoneRequest:
+				adapter.write(t, &dap.ConfigurationDoneResponse{Response: newResponse(req)})
+				adapter.write(t, &dap.LaunchResponse{Response: newResponse(launch)})
+				adapter.write(t, &dap.StoppedEvent{Event: newEvent("stopped"), Body: dap.StoppedEventBody{Reason: "entry", ThreadId: 1}})
+			case *dap.RestartRequest:
+				var args struct {
+					Arguments map[string]any `json:"arguments"`
+				}
+				if err := json.Unmarshal(req.Arguments, &args); err != nil {
+					t.Errorf("invalid restart arguments: %v", err)
+				}
+				restarts <- args.Arguments
+				adapter.write(t, &dap.RestartResponse{Response: newResponse(req)})
+			default:
+				t.Errorf("unexpected request %#v", req)
+				return
+			}
+		}
+	}()
+
+	ctx := context.Background()
+	if _, err := ds.debugProgram(ctx, nil, &mcp.CallToolParamsFor[DebugProgramParams]{Arguments: DebugProgramParams{
+		Path: "./app",
+		Env:  map[string]string{"A": "1", "B": "1"},
+	}}); err != nil {
+		t.Fatalf("debugProgram: %v", err)
+	}
+	if _, err := ds.configurationDone(ctx, nil, &mcp.CallToolParamsFor[ConfigurationDoneParams]{}); err != nil {
+		t.Fatalf("configurationDone: %v", err)
+	}
+	// lldb-dap launches the program again with the arguments of the restart request.
+	if _, err := ds.restartDebugger(ctx, nil, &mcp.CallToolParamsFor[RestartParams]{Arguments: RestartParams{Env: map[string]string{"B": "2"}}}); err != nil {
+		t.Fatalf("restartDebugger: %v", err)
+	}
+	got, _ := json.Marshal((<-restarts)["env"])
+	if want := `["A=1","B=2"]`; string(got) != want {
+		t.Errorf("got restart environment %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// traceMu serializes writes to trace files, so that sessions sharing
+// the file named by MCP_DAP_TRACE never interleave their lines.
+var traceMu sync.Mutex
+
+// redactedKeys are the message fields that hold variable values. They are
+// replaced when a trace is recorded with redaction turned on.
+var redactedKeys = map[string]bool{"value": true, "result": true}
+
+// traceEntry is a single line of a DAP trace file.
+type traceEntry struct {
+	Time      time.Time `json:"time"`
+	Session   string    `json:"session"`
+	Direction string    `json:"direction"`
+	// Message is the DAP message exactly as it went over the wire,
+	// unless values are redacted.
+	Message json.RawMessage `json:"message"`
+}
+
+// dapTracer records the DAP messages of a session as JSON lines.
+type dapTracer struct {
+	file    *os.File
+	session string
+	redact  bool
+}
+
+// newDAPTracer opens path for appending and returns a tracer that writes
+// the messages of the named session to it. When redact is set, variable
+// values and evaluation results are replaced by "<redacted>".
+func newDAPTracer(path, session string, redact bool) (*dapTracer, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &dapTracer{file: f, session: session, redact: redact}, nil
+}
+
+// trace records a message. It has the signature expected by DAPClient.SetTrace.
+func (t *dapTracer) trace(direction string, content []byte) {
+	message := json.RawMessage(content)
+	if t.redact {
+		message = redactValues(content)
+	}
+	line, err := json.Marshal(traceEntry{Time: time.Now(), Session: t.session, Direction: direction, Message: message})
+	if err != nil {
+		return
+	}
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	t.file.Write(append(line, '\n'))
+}
+
+// Close closes the trace file.
+func (t *dapTracer) Close() error {
+	return t.file.Close()
+}
+
+// redactValues returns content with the string fields listed in
+// redactedKeys replaced, at any depth. Content that is not valid JSON
+// is dropped entirely rather than risk leaking values.
+func redactValues(content []byte) json.RawMessage {
+	var msg any
+	if err := json.Unmarshal(content, &msg); err != nil {
+		return json.RawMessage(`"<redacted>"`)
+	}
+	redacted, err := json.Marshal(redactValue(msg))
+	if err != nil {
+		return json.RawMessage(`"<redacted>"`)
+	}
+	return redacted
+}
+
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if _, ok := value.(string); ok && redactedKeys[key] {
+				v[key] = "<redacted>"
+				continue
+			}
+			v[key] = redactValue(value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = redactValue(value)
+		}
+	}
+	return v
+}
+
+// newSessionID returns a random identifier for a debugger session.
+func newSessionID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-dap"
+)
+
+func TestDAPTrace(t *testing.T) {
+	for _, redact := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "trace.jsonl")
+		tracer, err := newDAPTracer(path, "s1", redact)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, adapter := newFakeAdapter(t)
+		client.SetTrace(tracer.trace)
+
+		go func() {
+			req := adapter.readRequest(t)
+			if req == nil {
+				return
+			}
+			adapter.write(t, &dap.EvaluateResponse{Response: newResponse(req), Body: dap.EvaluateResponseBody{Result: "secret"}})
+		}()
+		if _, err := client.EvaluateRequest(context.Background(), "password", 0, "repl"); err != nil {
+			t.Fatalf("EvaluateRequest: %v", err)
+		}
+		tracer.Close()
+
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		var entries []traceEntry
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var entry traceEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				t.Fatalf("invalid trace line %q: %v", scanner.Text(), err)
+			}
+			entries = append(entries, entry)
+		}
+		if len(entries) != 2 {
+			t.Fatalf("redact=%v: expected 2 trace entries, got %d", redact, len(entries))
+		}
+		if entries[0].Direction != "send" || entries[1].Direction != "recv" {
+			t.Errorf("redact=%v: unexpected directions %q, %q", redact, entries[0].Direction, entries[1].Direction)
+		}
+		for _, entry := range entries {
+			if entry.Session != "s1" || entry.Time.IsZero() {
+				t.Errorf("redact=%v: missing session or time in %+v", redact, entry)
+			}
+		}
+		if !strings.Contains(string(entries[0].Message), `"password"`) {
+			t.Errorf("redact=%v: request not traced: %s", redact, entries[0].Message)
+		}
+		if got := strings.Contains(string(entries[1].Message), "secret"); got == redact {
+			t.Errorf("redact=%v: response traced as %s", redact, entries[1].Message)
+		}
+	}
+}